@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	tokenHeader  = "X-Editor-Token"
+	tokenCookie  = "gofast_token"
+	tokenURLFile = "gofast_editor.url" // Next to gofast_editor.log
+)
+
+// apiToken is generated per launch and handed to the browser we open. Every
+// /api request must present it, so other pages in the same browser can't
+// drive the local API.
+var apiToken = newToken()
+
+func newToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal("Failed to generate API token: ", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// writeTokenURL saves the editor URL, token included, to a file only the
+// user can read, so the editor can be reopened if the browser tab is lost.
+// GUI builds have no console to print it to, and the log stays token-free.
+func writeTokenURL(url string) error {
+	os.Remove(tokenURLFile) // WriteFile keeps the mode of an existing file
+	return os.WriteFile(tokenURLFile, []byte(url+"\n"), 0600)
+}
+
+// allowedOrigins lists the origins allowed to call the API: the editor itself
+// plus any configured ones (e.g. the Vite dev server).
+func allowedOrigins(port string) []string {
+	return append([]string{
+		"http://localhost:" + port,
+		"http://127.0.0.1:" + port,
+	}, config.AllowedOrigins...)
+}
+
+// requireAPIAuth guards /api: it rejects foreign Host headers (DNS
+// rebinding), cross-site requests and requests without the launch token.
+// Visiting any page with ?token= stores the token in a cookie.
+func requireAPIAuth(port string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if host, _, err := net.SplitHostPort(r.Host); err != nil || (host != "localhost" && host != "127.0.0.1") {
+			rejectRequest(w, r, http.StatusForbidden, "unexpected host "+r.Host)
+			return
+		}
+
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			if token := r.URL.Query().Get("token"); token != "" && validToken(token) {
+				http.SetCookie(w, &http.Cookie{
+					Name:     tokenCookie,
+					Value:    token,
+					Path:     "/",
+					HttpOnly: true,
+					SameSite: http.SameSiteStrictMode,
+				})
+				http.Redirect(w, r, r.URL.Path, http.StatusFound)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		origin := r.Header.Get("Origin")
+		if origin != "" {
+			if !slices.Contains(allowedOrigins(port), origin) {
+				rejectRequest(w, r, http.StatusForbidden, "origin "+origin+" not allowed")
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Add("Vary", "Origin")
+		} else if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+			rejectRequest(w, r, http.StatusForbidden, "cross-site request")
+			return
+		}
+
+		// Preflights carry no credentials; the real request is checked below
+		if r.Method == "OPTIONS" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := r.Header.Get(tokenHeader)
+		if token == "" {
+			if c, err := r.Cookie(tokenCookie); err == nil {
+				token = c.Value
+			}
+		}
+		if !validToken(token) {
+			rejectRequest(w, r, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func validToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) == 1
+}
+
+func rejectRequest(w http.ResponseWriter, r *http.Request, status int, reason string) {
+	log.Printf("Rejected %s %s from %s: %s\n", r.Method, r.URL.Path, r.RemoteAddr, reason)
+	http.Error(w, reason, status)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestRequireAPIAuth(t *testing.T) {
+	saved := config.AllowedOrigins
+	config.AllowedOrigins = []string{"http://localhost:5173"}
+	defer func() { config.AllowedOrigins = saved }()
+
+	handler := requireAPIAuth("8080", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot) // Reached the API
+	}))
+
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		host    string
+		headers map[string]string
+		cookie  string
+		want    int
+		origin  string // Expected Access-Control-Allow-Origin
+	}{
+		{name: "token header", url: "/api/fs/list", headers: map[string]string{tokenHeader: apiToken}, want: http.StatusTeapot},
+		{name: "token cookie", url: "/api/fs/list", cookie: apiToken, want: http.StatusTeapot},
+		{name: "no token", url: "/api/fs/list", want: http.StatusUnauthorized},
+		{name: "wrong token", url: "/api/fs/list", headers: map[string]string{tokenHeader: "x" + apiToken}, want: http.StatusUnauthorized},
+		{name: "wrong cookie", url: "/api/fs/list", cookie: "nope", want: http.StatusUnauthorized},
+		{name: "127.0.0.1 host", url: "/api/fs/list", host: "127.0.0.1:8080", cookie: apiToken, want: http.StatusTeapot},
+		{name: "rebound host", url: "/api/fs/list", host: "evil.example:8080", cookie: apiToken, want: http.StatusForbidden},
+		{name: "host without port", url: "/api/fs/list", host: "localhost", cookie: apiToken, want: http.StatusForbidden},
+		{name: "foreign host for pages too", url: "/", host: "evil.example:8080", want: http.StatusForbidden},
+		{
+			name: "own origin", url: "/api/fs/list", cookie: apiToken,
+			headers: map[string]string{"Origin": "http://localhost:8080"},
+			want:    http.StatusTeapot, origin: "http://localhost:8080",
+		},
+		{
+			name: "configured origin", url: "/api/fs/list", cookie: apiToken,
+			headers: map[string]string{"Origin": "http://localhost:5173"},
+			want:    http.StatusTeapot, origin: "http://localhost:5173",
+		},
+		{
+			name: "foreign origin", url: "/api/fs/list", cookie: apiToken,
+			headers: map[string]string{"Origin": "http://evil.example"},
+			want:    http.StatusForbidden,
+		},
+		{
+			name: "cross-site without origin", url: "/api/fs/list", cookie: apiToken,
+			headers: map[string]string{"Sec-Fetch-Site": "cross-site"},
+			want:    http.StatusForbidden,
+		},
+		{
+			name: "same-origin fetch", url: "/api/fs/list", cookie: apiToken,
+			headers: map[string]string{"Sec-Fetch-Site": "same-origin"},
+			want:    http.StatusTeapot,
+		},
+		{
+			name: "preflight needs no token", method: "OPTIONS", url: "/api/fs/list",
+			headers: map[string]string{"Origin": "http://localhost:5173"},
+			want:    http.StatusTeapot, origin: "http://localhost:5173",
+		},
+		{
+			name: "foreign preflight", method: "OPTIONS", url: "/api/fs/list",
+			headers: map[string]string{"Origin": "http://evil.example"},
+			want:    http.StatusForbidden,
+		},
+		{name: "page without token", url: "/index.html", want: http.StatusTeapot},
+		{name: "page with wrong token", url: "/?token=nope", want: http.StatusTeapot},
+		{name: "page with token", url: "/?token=" + apiToken, want: http.StatusFound},
+	}
+	for _, tt := range tests {
+		method := tt.method
+		if method == "" {
+			method = "GET"
+		}
+		r := httptest.NewRequest(method, tt.url, nil)
+		r.Host = "localhost:8080"
+		if tt.host != "" {
+			r.Host = tt.host
+		}
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		if tt.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: tokenCookie, Value: tt.cookie})
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.origin {
+			t.Errorf("%s: Access-Control-Allow-Origin %q, want %q", tt.name, got, tt.origin)
+		}
+	}
+}
+
+func TestTokenCookie(t *testing.T) {
+	handler := requireAPIAuth("8080", http.NotFoundHandler())
+	r := httptest.NewRequest("GET", "/app?token="+apiToken, nil)
+	r.Host = "localhost:8080"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if loc := w.Header().Get("Location"); loc != "/app" {
+		t.Errorf("redirect to %q, want the URL without the token", loc)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+	c := cookies[0]
+	if c.Name != tokenCookie || c.Value != apiToken || !c.HttpOnly || c.SameSite != http.SameSiteStrictMode || c.Path != "/" {
+		t.Errorf("cookie = %+v, want an HttpOnly, SameSite=Strict token cookie for /", c)
+	}
+}
+
+func TestWriteTokenURL(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(tokenURLFile, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTokenURL("http://localhost:8080/?token=t"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(tokenURLFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("mode %v, want 0600", info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(tokenURLFile); string(data) != "http://localhost:8080/?token=t\n" {
+		t.Errorf("content %q", data)
+	}
+}
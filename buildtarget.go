@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"go/build"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// BuildTarget selects the platform build constraints are evaluated against.
+// Empty fields fall back to the host.
+type BuildTarget struct {
+	GOOS   string   `json:"goos"`
+	GOARCH string   `json:"goarch"`
+	Tags   []string `json:"tags"`
+}
+
+// hostBuildContext is the build context of the machine the editor runs on.
+var hostBuildContext = build.Default
+
+// indexBuildContext is the build context used to evaluate build constraints.
+func indexBuildContext() *build.Context {
+	ctxt := hostBuildContext
+	t := config.Target
+	if t.GOOS != "" {
+		ctxt.GOOS = t.GOOS
+	}
+	if t.GOARCH != "" {
+		ctxt.GOARCH = t.GOARCH
+	}
+	ctxt.BuildTags = append([]string{}, t.Tags...)
+	// Like the go command, cgo is off when cross-compiling
+	if ctxt.GOOS != hostBuildContext.GOOS || ctxt.GOARCH != hostBuildContext.GOARCH {
+		ctxt.CgoEnabled = false
+	}
+	return &ctxt
+}
+
+// fileConstraint describes why a file may be excluded: its //go:build
+// expression, or its GOOS/GOARCH file name suffix.
+func fileConstraint(path string) string {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly|parser.ParseComments)
+	if err == nil {
+		for _, group := range f.Comments {
+			if group.Pos() > f.Package {
+				break
+			}
+			for _, c := range group.List {
+				if constraint.IsGoBuild(c.Text) {
+					return strings.TrimSpace(strings.TrimPrefix(c.Text, "//go:build"))
+				}
+			}
+		}
+	}
+
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".go"), "_test")
+	if i := strings.Index(name, "_"); i >= 0 {
+		return "file name " + name[i:] + ".go"
+	}
+	return ""
+}
+
+func validTargetWord(s string) bool {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func validBuildTag(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// handleBuildTarget reports the target build constraints are evaluated
+// against. A POST changes it and re-indexes the workspace.
+func handleBuildTarget(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if r.Method == "POST" {
+		var req BuildTarget
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !validTargetWord(req.GOOS) || !validTargetWord(req.GOARCH) {
+			http.Error(w, "Invalid GOOS or GOARCH", http.StatusBadRequest)
+			return
+		}
+		for _, tag := range req.Tags {
+			if !validBuildTag(tag) {
+				http.Error(w, "Invalid build tag: "+tag, http.StatusBadRequest)
+				return
+			}
+		}
+
+		config.Target = req
+		saveConfig()
+		if currentWorkDir != "" {
+			updateIndex(currentWorkDir)
+		}
+	}
+
+	ctxt := indexBuildContext()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"goos":       ctxt.GOOS,
+		"goarch":     ctxt.GOARCH,
+		"tags":       ctxt.BuildTags,
+		"cgoEnabled": ctxt.CgoEnabled,
+		"configured": config.Target,
+	})
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"net/http"
+	"sort"
+)
+
+type CallHierarchyItem struct {
+	Name      string `json:"name"` // Qualified, e.g. main.handleRun or (*main.Server).Start
+	Kind      string `json:"kind"` // Function or Method
+	Package   string `json:"package"`
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+	Character int    `json:"character"`
+	External  bool   `json:"external"` // Outside the workspace, can't be expanded further
+}
+
+type CallSite struct {
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+	Character int    `json:"character"`
+}
+
+// CallHierarchyCall is one caller (incoming) or callee (outgoing) of the item,
+// with every call site between the two.
+type CallHierarchyCall struct {
+	CallHierarchyItem
+	Calls []CallSite `json:"calls"`
+}
+
+type CallHierarchyResponse struct {
+	Item      CallHierarchyItem   `json:"item"`
+	Direction string              `json:"direction"` // incoming or outgoing
+	Calls     []CallHierarchyCall `json:"calls"`
+}
+
+// callEdge is a static call from one function to another.
+type callEdge struct {
+	Caller *types.Func
+	Callee *types.Func
+	Pos    token.Pos
+}
+
+// callGraph indexes the static calls in the workspace by both ends.
+type callGraph struct {
+	In  map[*types.Func][]callEdge
+	Out map[*types.Func][]callEdge
+}
+
+// handleCallHierarchy answers
+// /api/callhierarchy?path=&line=&character=&direction=incoming|outgoing
+// with one level of callers or callees for the function at that position.
+// Each returned call carries a position that can be queried again to expand
+// the next level.
+func handleCallHierarchy(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	direction := r.URL.Query().Get("direction")
+	if direction == "" {
+		direction = "incoming"
+	}
+	if direction != "incoming" && direction != "outgoing" {
+		http.Error(w, "direction must be incoming or outgoing", http.StatusBadRequest)
+		return
+	}
+
+	ws, obj, ok := resolveQueryObject(w, r)
+	if !ok {
+		return
+	}
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		http.Error(w, "Not a function or method", http.StatusBadRequest)
+		return
+	}
+	fn = fn.Origin()
+
+	graph := ws.callGraph()
+	edges := graph.In[fn]
+	if direction == "outgoing" {
+		edges = graph.Out[fn]
+	}
+
+	// Group call sites by the function at the other end
+	byFunc := map[*types.Func]*CallHierarchyCall{}
+	var order []*types.Func
+	for _, e := range edges {
+		other := e.Caller
+		if direction == "outgoing" {
+			other = e.Callee
+		}
+		call, ok := byFunc[other]
+		if !ok {
+			call = &CallHierarchyCall{CallHierarchyItem: ws.callItem(other)}
+			byFunc[other] = call
+			order = append(order, other)
+		}
+		pos := ws.Fset.Position(e.Pos)
+		call.Calls = append(call.Calls, CallSite{Path: pos.Filename, Line: pos.Line, Character: pos.Column})
+	}
+
+	resp := CallHierarchyResponse{
+		Item:      ws.callItem(fn),
+		Direction: direction,
+		Calls:     []CallHierarchyCall{},
+	}
+	for _, f := range order {
+		resp.Calls = append(resp.Calls, *byFunc[f])
+	}
+	sort.SliceStable(resp.Calls, func(i, j int) bool {
+		a, b := resp.Calls[i], resp.Calls[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Line < b.Line
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// callGraph builds the static call graph of the workspace on first use.
+// Calls through interfaces point at the interface method, and calls made
+// inside function literals are attributed to the enclosing declaration.
+func (ws *typedWorkspace) callGraph() *callGraph {
+	ws.graphOnce.Do(func() {
+		g := &callGraph{
+			In:  map[*types.Func][]callEdge{},
+			Out: map[*types.Func][]callEdge{},
+		}
+		for _, pkg := range ws.Packages {
+			for _, f := range pkg.Files {
+				for _, decl := range f.Decls {
+					fd, ok := decl.(*ast.FuncDecl)
+					if !ok || fd.Body == nil {
+						continue
+					}
+					caller, ok := pkg.Info.Defs[fd.Name].(*types.Func)
+					if !ok {
+						continue
+					}
+					ast.Inspect(fd.Body, func(n ast.Node) bool {
+						call, ok := n.(*ast.CallExpr)
+						if !ok {
+							return true
+						}
+						callee := calledFunc(pkg.Info, call)
+						if callee == nil {
+							return true
+						}
+						e := callEdge{Caller: caller, Callee: callee, Pos: call.Lparen}
+						g.Out[caller] = append(g.Out[caller], e)
+						g.In[callee] = append(g.In[callee], e)
+						return true
+					})
+				}
+			}
+		}
+		ws.graph = g
+	})
+	return ws.graph
+}
+
+// calledFunc returns the statically known function or method a call
+// expression invokes, or nil for conversions, builtins and func values.
+func calledFunc(info *types.Info, call *ast.CallExpr) *types.Func {
+	fun := ast.Unparen(call.Fun)
+	// Strip explicit instantiation: f[int](x)
+	switch f := fun.(type) {
+	case *ast.IndexExpr:
+		fun = f.X
+	case *ast.IndexListExpr:
+		fun = f.X
+	}
+
+	var obj types.Object
+	switch f := fun.(type) {
+	case *ast.Ident:
+		obj = info.Uses[f]
+	case *ast.SelectorExpr:
+		if sel, ok := info.Selections[f]; ok {
+			obj = sel.Obj()
+		} else {
+			obj = info.Uses[f.Sel] // Qualified identifier, pkg.Func
+		}
+	}
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return nil
+	}
+	return fn.Origin()
+}
+
+func (ws *typedWorkspace) callItem(fn *types.Func) CallHierarchyItem {
+	item := CallHierarchyItem{
+		Name: fn.FullName(),
+		Kind: "Function",
+	}
+	if sig, ok := fn.Type().(*types.Signature); ok && sig.Recv() != nil {
+		item.Kind = "Method"
+	}
+	if fn.Pkg() != nil {
+		item.Package = fn.Pkg().Path()
+		item.External = ws.Packages[item.Package] == nil
+	}
+	if fn.Pos() != token.NoPos {
+		pos := ws.Fset.Position(fn.Pos())
+		item.Path = pos.Filename
+		item.Line = pos.Line
+		item.Character = pos.Column
+	}
+	return item
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Line diff operations.
+const (
+	diffEqual  = ' '
+	diffDelete = '-'
+	diffInsert = '+'
+)
+
+type diffOp struct {
+	Kind byte
+	Line string
+}
+
+// DiffHunk is one hunk of a unified diff. Lines carry their ' ', '-' or '+'
+// prefix. Starts are 1-based; a zero-length side starts at the line before.
+type DiffHunk struct {
+	OldStart int      `json:"oldStart"`
+	OldLines int      `json:"oldLines"`
+	NewStart int      `json:"newStart"`
+	NewLines int      `json:"newLines"`
+	Lines    []string `json:"lines"`
+}
+
+// splitLines splits text into lines without their LF or CRLF terminators.
+// A final newline doesn't start an extra empty line.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+// Limits that keep diffing cheap on large or unrelated inputs. Past them a
+// differing region is reported as deleted and inserted wholesale.
+const (
+	maxDiffLines = 50000 // Lines left after trimming the common prefix and suffix
+	maxDiffEdits = 2000  // Edit distance the search explores per region
+)
+
+// diffLines computes a line edit script from a to b. It is minimal (Myers)
+// unless the inputs exceed maxDiffLines or maxDiffEdits.
+func diffLines(a, b []string) []diffOp {
+	// Common prefix and suffix don't need the O(ND) search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{diffEqual, line})
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(midA)+len(midB) > maxDiffLines {
+		ops = replaceOps(ops, midA, midB)
+	} else {
+		ops = myers(midA, midB, ops)
+	}
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{diffEqual, line})
+	}
+	return ops
+}
+
+// replaceOps appends a as deleted and b as inserted.
+func replaceOps(ops []diffOp, a, b []string) []diffOp {
+	for _, line := range a {
+		ops = append(ops, diffOp{diffDelete, line})
+	}
+	for _, line := range b {
+		ops = append(ops, diffOp{diffInsert, line})
+	}
+	return ops
+}
+
+// myers appends the edit script from a to b. It splits the problem at the
+// middle snake and recurses on both halves, so memory stays linear.
+func myers(a, b []string, ops []diffOp) []diffOp {
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		ops = append(ops, diffOp{diffEqual, a[0]})
+		a, b = a[1:], b[1:]
+	}
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	tail := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	if len(a) == 0 || len(b) == 0 {
+		ops = replaceOps(ops, a, b)
+	} else if x, y, u, v, ok := middleSnake(a, b); !ok {
+		ops = replaceOps(ops, a, b)
+	} else {
+		// Both ends differ here, so the edit distance is at least 2 and
+		// each half is strictly smaller
+		ops = myers(a[:x], b[:y], ops)
+		for _, line := range a[x:u] {
+			ops = append(ops, diffOp{diffEqual, line})
+		}
+		ops = myers(a[u:], b[v:], ops)
+	}
+
+	for _, line := range tail {
+		ops = append(ops, diffOp{diffEqual, line})
+	}
+	return ops
+}
+
+// middleSnake finds the middle snake of an optimal path from (0,0) to
+// (len(a),len(b)) by searching forward and backward at once, returning its
+// start (x,y) and end (u,v). ok is false if the edit distance exceeds
+// maxDiffEdits.
+func middleSnake(a, b []string) (x, y, u, v int, ok bool) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	maxD := min((n+m+1)/2, maxDiffEdits/2)
+
+	// vf[k] is the furthest x on diagonal k = x-y going forward; vb[c] the
+	// furthest distance from the end on diagonal c going backward, where
+	// c = delta-k for the same forward diagonal.
+	off := maxD + 1
+	vf := make([]int, 2*maxD+3)
+	vb := make([]int, 2*maxD+3)
+
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			if c := delta - k; odd && c >= -(d-1) && c <= d-1 && x+vb[off+c] >= n {
+				return x0, y0, x, y, true
+			}
+		}
+		for c := -d; c <= d; c += 2 {
+			var xr int
+			if c == -d || (c != d && vb[off+c-1] < vb[off+c+1]) {
+				xr = vb[off+c+1]
+			} else {
+				xr = vb[off+c-1] + 1
+			}
+			yr := xr - c
+			x0, y0 := xr, yr
+			for xr < n && yr < m && a[n-1-xr] == b[m-1-yr] {
+				xr++
+				yr++
+			}
+			vb[off+c] = xr
+			if k := delta - c; !odd && k >= -d && k <= d && vf[off+k]+xr >= n {
+				return n - xr, m - yr, n - x0, m - y0, true
+			}
+		}
+	}
+	return 0, 0, 0, 0, false
+}
+
+// diffHunks groups an edit script into hunks with the given lines of context.
+func diffHunks(ops []diffOp, context int) []DiffHunk {
+	var hunks []DiffHunk
+	var cur *DiffHunk
+	oldLine, newLine := 1, 1
+	lastChange := -1
+
+	// closeHunk adds trailing context to the current hunk and finishes it
+	closeHunk := func() {
+		for _, c := range ops[lastChange+1 : min(lastChange+1+context, len(ops))] {
+			cur.Lines = append(cur.Lines, " "+c.Line)
+			cur.OldLines++
+			cur.NewLines++
+		}
+		hunks = append(hunks, *cur)
+	}
+
+	for i, op := range ops {
+		if op.Kind != diffEqual {
+			if cur == nil || i-lastChange-1 > 2*context {
+				if cur != nil {
+					closeHunk()
+				}
+				// Start a new hunk with up to context lines before the change
+				start := max(i-context, lastChange+1, 0)
+				cur = &DiffHunk{
+					OldStart: oldLine - (i - start),
+					NewStart: newLine - (i - start),
+				}
+				for _, c := range ops[start:i] {
+					cur.Lines = append(cur.Lines, " "+c.Line)
+					cur.OldLines++
+					cur.NewLines++
+				}
+			} else {
+				// Context between two changes of the same hunk
+				for _, c := range ops[lastChange+1 : i] {
+					cur.Lines = append(cur.Lines, " "+c.Line)
+					cur.OldLines++
+					cur.NewLines++
+				}
+			}
+			cur.Lines = append(cur.Lines, string(op.Kind)+op.Line)
+			if op.Kind == diffDelete {
+				cur.OldLines++
+			} else {
+				cur.NewLines++
+			}
+			lastChange = i
+		}
+
+		if op.Kind != diffInsert {
+			oldLine++
+		}
+		if op.Kind != diffDelete {
+			newLine++
+		}
+	}
+
+	if cur != nil {
+		closeHunk()
+	}
+
+	// Unified diff convention: an empty side starts at the line before
+	for i := range hunks {
+		if hunks[i].OldLines == 0 {
+			hunks[i].OldStart--
+		}
+		if hunks[i].NewLines == 0 {
+			hunks[i].NewStart--
+		}
+	}
+	return hunks
+}
+
+// unifiedDiff renders hunks as a unified diff between two named files.
+func unifiedDiff(fromName, toName string, hunks []DiffHunk) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+	for _, h := range hunks {
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+		for _, line := range h.Lines {
+			sb.WriteString(line)
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// applyOps returns both sides an edit script describes.
+func applyOps(ops []diffOp) (a, b []string) {
+	for _, op := range ops {
+		if op.Kind != diffInsert {
+			a = append(a, op.Line)
+		}
+		if op.Kind != diffDelete {
+			b = append(b, op.Line)
+		}
+	}
+	return a, b
+}
+
+func editCount(ops []diffOp) int {
+	n := 0
+	for _, op := range ops {
+		if op.Kind != diffEqual {
+			n++
+		}
+	}
+	return n
+}
+
+// lcsDistance is the minimal edit distance by dynamic programming.
+func lcsDistance(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return len(a) + len(b) - 2*dp[0][0]
+}
+
+func randomLines(r *rand.Rand, n, alphabet int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = string(rune('a' + r.Intn(alphabet)))
+	}
+	return lines
+}
+
+func TestSplitLines(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"a", []string{"a"}},
+		{"a\n", []string{"a"}},
+		{"a\r\nb\r\n", []string{"a", "b"}},
+		{"a\n\nb", []string{"a", "", "b"}},
+		{"\n", []string{""}},
+	}
+	for _, tt := range tests {
+		if got := splitLines(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitLines(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string // Kinds of the ops
+	}{
+		{"", "", ""},
+		{"a b c", "a b c", "   "},
+		{"", "a b", "++"},
+		{"a b", "", "--"},
+		{"a b c", "a x c", " -+ "},
+		{"a b c", "a c", " - "},
+		{"a c", "a b c", " + "},
+	}
+	for _, tt := range tests {
+		ops := diffLines(strings.Fields(tt.a), strings.Fields(tt.b))
+		var kinds strings.Builder
+		for _, op := range ops {
+			kinds.WriteByte(op.Kind)
+		}
+		if kinds.String() != tt.want {
+			t.Errorf("diffLines(%q, %q) = %q, want %q", tt.a, tt.b, kinds.String(), tt.want)
+		}
+	}
+}
+
+func TestDiffLinesRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		a := randomLines(r, r.Intn(30), 1+r.Intn(5))
+		b := randomLines(r, r.Intn(30), 1+r.Intn(5))
+		ops := diffLines(a, b)
+		gotA, gotB := applyOps(ops)
+		if strings.Join(gotA, ",") != strings.Join(a, ",") || strings.Join(gotB, ",") != strings.Join(b, ",") {
+			t.Fatalf("diffLines(%q, %q) does not reproduce its inputs: %v", a, b, ops)
+		}
+		if got, want := editCount(ops), lcsDistance(a, b); got != want {
+			t.Fatalf("diffLines(%q, %q) has %d edits, want %d", a, b, got, want)
+		}
+	}
+}
+
+func TestDiffLinesLarge(t *testing.T) {
+	// Unrelated inputs exceed the edit limit and are replaced wholesale
+	a := make([]string, 20000)
+	b := make([]string, 20000)
+	for i := range a {
+		a[i] = "a" + strconv.Itoa(i)
+		b[i] = "b" + strconv.Itoa(i)
+	}
+	start := time.Now()
+	ops := diffLines(a, b)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("diffLines took %v on unrelated inputs", elapsed)
+	}
+	if gotA, gotB := applyOps(ops); !reflect.DeepEqual(gotA, a) || !reflect.DeepEqual(gotB, b) {
+		t.Fatal("diffLines does not reproduce unrelated inputs")
+	}
+
+	// A few scattered edits in a large file stay minimal
+	c := append([]string{}, a...)
+	for i := 1000; i < len(c); i += 5000 {
+		c[i] = "changed"
+	}
+	if got := editCount(diffLines(a, c)); got != 8 {
+		t.Errorf("scattered edits: %d edits, want 8", got)
+	}
+
+	// Over the line limit, the differing middle is replaced wholesale
+	big := make([]string, maxDiffLines)
+	for i := range big {
+		big[i] = strconv.Itoa(i)
+	}
+	edited := append(append(append([]string{}, big[:10]...), "inserted"), big[10:]...)
+	if got := editCount(diffLines(big, edited)); got != 1 {
+		t.Errorf("insert in a large file: %d edits, want 1", got)
+	}
+	edited[0], edited[len(edited)-1] = "x", "y"
+	if got := editCount(diffLines(big, edited)); got != 2*len(big)+1 {
+		t.Errorf("over the limit: %d edits, want %d", got, 2*len(big)+1)
+	}
+}
+
+// applyHunks applies hunks to a, checking their context against it.
+func applyHunks(t *testing.T, a []string, hunks []DiffHunk) []string {
+	var out []string
+	next := 0 // Index into a of the first line not yet copied
+	for _, h := range hunks {
+		start := h.OldStart - 1
+		if h.OldLines == 0 {
+			start = h.OldStart
+		}
+		out = append(out, a[next:start]...)
+		next = start
+		for _, line := range h.Lines {
+			switch line[0] {
+			case diffEqual, diffDelete:
+				if a[next] != line[1:] {
+					t.Fatalf("hunk %+v: line %d is %q, want %q", h, next+1, a[next], line[1:])
+				}
+				if line[0] == diffEqual {
+					out = append(out, line[1:])
+				}
+				next++
+			case diffInsert:
+				out = append(out, line[1:])
+			}
+		}
+	}
+	return append(out, a[next:]...)
+}
+
+func TestDiffHunks(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 2000; i++ {
+		a := randomLines(r, r.Intn(40), 3)
+		b := append([]string{}, a...)
+		for j := r.Intn(4); j > 0 && len(b) > 0; j-- {
+			b[r.Intn(len(b))] = "x"
+		}
+		if r.Intn(2) == 0 {
+			b = append(b, "y")
+		}
+		for _, context := range []int{0, 1, 3} {
+			hunks := diffHunks(diffLines(a, b), context)
+			if got := applyHunks(t, a, hunks); strings.Join(got, ",") != strings.Join(b, ",") {
+				t.Fatalf("context %d: hunks %+v turn %q into %q, want %q", context, hunks, a, got, b)
+			}
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := []string{"one", "two", "three"}
+	b := []string{"one", "2", "three", "four"}
+	got := unifiedDiff("a/f", "b/f", diffHunks(diffLines(a, b), 3))
+	want := "--- a/f\n+++ b/f\n@@ -1,3 +1,4 @@\n one\n-two\n+2\n three\n+four\n"
+	if got != want {
+		t.Errorf("unifiedDiff = %q, want %q", got, want)
+	}
+	if got := unifiedDiff("a", "b", nil); got != "" {
+		t.Errorf("unifiedDiff of no hunks = %q, want empty", got)
+	}
+}
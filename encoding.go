@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Text encodings the editor reads and writes. Files that are neither UTF-8
+// (with or without BOM), UTF-16 with a BOM nor GBK are read as Latin-1,
+// which maps every byte and so round-trips unchanged.
+const (
+	encUTF8    = "utf-8"
+	encUTF8BOM = "utf-8-bom"
+	encUTF16LE = "utf-16le"
+	encUTF16BE = "utf-16be"
+	encGBK     = "gbk"
+	encLatin1  = "latin1"
+)
+
+var textEncodings = map[string]encoding.Encoding{
+	encUTF8:    unicode.UTF8,
+	encUTF8BOM: unicode.UTF8BOM,
+	encUTF16LE: unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM),
+	encUTF16BE: unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM),
+	encGBK:     simplifiedchinese.GBK,
+	encLatin1:  charmap.ISO8859_1,
+}
+
+var errEncoding = errors.New("encoding error")
+
+// detectEncoding guesses the encoding of file content: a BOM wins, then
+// valid UTF-8, then GBK if it decodes cleanly.
+func detectEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return encUTF8BOM
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return encUTF16LE
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return encUTF16BE
+	case utf8.Valid(data):
+		return encUTF8
+	case looksLikeGBK(data):
+		return encGBK
+	}
+	return encLatin1
+}
+
+// looksLikeGBK reports whether data decodes as GBK without invalid sequences
+// or stray control characters.
+func looksLikeGBK(data []byte) bool {
+	decoded, err := simplifiedchinese.GBK.NewDecoder().Bytes(data)
+	if err != nil {
+		return false
+	}
+	for _, r := range string(decoded) {
+		if r == utf8.RuneError || (r < 0x20 && r != '\t' && r != '\n' && r != '\r' && r != '\f') {
+			return false
+		}
+	}
+	return true
+}
+
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	enc, ok := textEncodings[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported encoding %q", errEncoding, name)
+	}
+	return enc, nil
+}
+
+// decodeText converts file content in the named encoding to UTF-8 text,
+// dropping any BOM.
+func decodeText(data []byte, name string) (string, error) {
+	enc, err := lookupEncoding(name)
+	if err != nil {
+		return "", err
+	}
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errEncoding, err)
+	}
+	return string(decoded), nil
+}
+
+// decodeFile detects the encoding of file content and decodes it, falling
+// back to the raw bytes.
+func decodeFile(data []byte) (string, string) {
+	name := detectEncoding(data)
+	text, err := decodeText(data, name)
+	if err != nil {
+		return string(data), encUTF8
+	}
+	return text, name
+}
+
+// encodeText converts UTF-8 text to the named encoding, adding its BOM if it
+// has one. Characters the encoding can't represent are an error rather than
+// being silently replaced.
+func encodeText(text string, name string) ([]byte, error) {
+	enc, err := lookupEncoding(name)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := enc.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		return nil, fmt.Errorf("%w: content can't be saved as %s: %v", errEncoding, name, err)
+	}
+	return encoded, nil
+}
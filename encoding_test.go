@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{nil, encUTF8},
+		{[]byte("plain ascii\n"), encUTF8},
+		{[]byte("中文\n"), encUTF8},
+		{[]byte("\xEF\xBB\xBFbom"), encUTF8BOM},
+		{[]byte("\xFF\xFEa\x00"), encUTF16LE},
+		{[]byte("\xFE\xFF\x00a"), encUTF16BE},
+		{[]byte("\xD6\xD0\xCE\xC4\n"), encGBK},      // 中文
+		{[]byte("caf\xE9\n"), encLatin1},            // Not a valid GBK sequence
+		{[]byte("\xD6\xD0\x01\xCE\xC4"), encLatin1}, // GBK but with a control character
+	}
+	for _, tt := range tests {
+		if got := detectEncoding(tt.data); got != tt.want {
+			t.Errorf("detectEncoding(%q) = %s, want %s", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestEncodingRoundTrip(t *testing.T) {
+	tests := []struct {
+		enc  string
+		text string
+	}{
+		{encUTF8, "héllo, 世界\r\n"},
+		{encUTF8BOM, "héllo, 世界\n"},
+		{encUTF16LE, "héllo, 世界 😀\n"},
+		{encUTF16BE, "héllo, 世界 😀\n"},
+		{encGBK, "你好,世界\n"},
+		{encLatin1, "café £5\n"},
+	}
+	for _, tt := range tests {
+		data, err := encodeText(tt.text, tt.enc)
+		if err != nil {
+			t.Errorf("encodeText(%q, %s): %v", tt.text, tt.enc, err)
+			continue
+		}
+		text, enc := decodeFile(data)
+		if text != tt.text || enc != tt.enc {
+			t.Errorf("decodeFile(encodeText(%q, %s)) = %q, %s", tt.text, tt.enc, text, enc)
+		}
+	}
+}
+
+func TestEncodingErrors(t *testing.T) {
+	if _, err := encodeText("世界", encLatin1); !errors.Is(err, errEncoding) {
+		t.Errorf("encoding CJK as latin1: err = %v, want errEncoding", err)
+	}
+	if _, err := encodeText("x", "ebcdic"); !errors.Is(err, errEncoding) {
+		t.Errorf("unknown encoding: err = %v, want errEncoding", err)
+	}
+	if _, err := decodeText([]byte("x"), "UTF-8"); err != nil {
+		t.Errorf("encoding names should be case-insensitive: %v", err)
+	}
+
+	// Every byte is valid Latin-1, so arbitrary binary data round-trips
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	text, err := decodeText(data, encLatin1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back, err := encodeText(text, encLatin1); err != nil || string(back) != string(data) {
+		t.Errorf("latin1 round trip = %q, %v", back, err)
+	}
+}
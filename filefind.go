@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fileListTTL      = 30 * time.Second // Catch changes made outside the editor
+	maxFileListSize  = 200000
+	defaultFindLimit = 50
+	maxFindLimit     = 500
+)
+
+// fileList caches the workspace's files (slash-separated, relative to
+// root) for quick open. Editor file operations and watcher events that
+// create or delete files invalidate it; anything else is picked up once it
+// is older than fileListTTL.
+var (
+	fileList      []string
+	fileListRoot  string
+	fileListBuilt time.Time
+	fileListMutex sync.Mutex
+)
+
+var errFileListFull = errors.New("file list limit reached")
+
+func invalidateFileList() {
+	fileListMutex.Lock()
+	fileListBuilt = time.Time{}
+	fileListMutex.Unlock()
+}
+
+// workspaceFiles returns the cached file list, rebuilding it if needed.
+func workspaceFiles(root string) []string {
+	fileListMutex.Lock()
+	defer fileListMutex.Unlock()
+	if fileListRoot == root && time.Since(fileListBuilt) < fileListTTL {
+		return fileList
+	}
+
+	var files []string
+	walkSearchFiles(context.Background(), root, nil, nil, func(p, rel string) error {
+		files = append(files, rel)
+		if len(files) >= maxFileListSize {
+			return errFileListFull
+		}
+		return nil
+	})
+	fileList, fileListRoot, fileListBuilt = files, root, time.Now()
+	return files
+}
+
+// FileMatch is a quick-open result.
+type FileMatch struct {
+	Path    string `json:"path"`
+	RelPath string `json:"relPath"`
+	Name    string `json:"name"`
+	Score   int    `json:"score"`
+	Match   string `json:"match"`
+}
+
+// scoreFile ranks a relative path for a quick-open query. The last segment
+// of the query is matched against the file name like a symbol name; any
+// earlier segments ("api/hand") must appear in order in the directory.
+// Queries without a slash also fall back to a fuzzy match over the path.
+func scoreFile(rel, q string) (int, string) {
+	dir, name := path.Split(rel)
+	q = strings.ReplaceAll(q, `\`, "/")
+	qDir, qName := path.Split(q)
+
+	score, kind := scoreSymbol(name, qName)
+	if qDir != "" {
+		if score == 0 {
+			return 0, ""
+		}
+		spread := fuzzyMatch([]rune(strings.ToLower(dir)), []rune(strings.ToLower(strings.Trim(qDir, "/"))))
+		if spread < 0 {
+			return 0, ""
+		}
+		return max(score-spread, 1), kind
+	}
+	if score > 0 {
+		return score, kind
+	}
+	if spread := fuzzyMatch([]rune(strings.ToLower(rel)), []rune(strings.ToLower(q))); spread >= 0 {
+		return max(scoreFuzzy/2-spread, 1), "path"
+	}
+	return 0, ""
+}
+
+// handleFindFiles returns workspace files ranked against q, for opening a
+// file by name.
+func handleFindFiles(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if currentWorkDir == "" {
+		http.Error(w, "No workspace directory set", http.StatusBadRequest)
+		return
+	}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	limit := defaultFindLimit
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = min(n, maxFindLimit)
+	}
+
+	root := currentWorkDir
+	var results []FileMatch
+	for _, rel := range workspaceFiles(root) {
+		score, kind := scoreFile(rel, q)
+		if score == 0 {
+			continue
+		}
+		results = append(results, FileMatch{
+			Path:    filepath.Join(root, filepath.FromSlash(rel)),
+			RelPath: rel,
+			Name:    path.Base(rel),
+			Score:   score,
+			Match:   kind,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if len(a.RelPath) != len(b.RelPath) {
+			return len(a.RelPath) < len(b.RelPath)
+		}
+		return a.RelPath < b.RelPath
+	})
+	total := len(results)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	if results == nil {
+		results = []FileMatch{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"total": total, "results": results})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestScoreFile(t *testing.T) {
+	tests := []struct {
+		rel, q string
+		kind   string // "" for no match
+	}{
+		{"handlers.go", "handlers.go", "exact"},
+		{"api/handlers.go", "hand", "prefix"},
+		{"api/gitBranch.go", "gb", "camel"},
+		{"api/handlers.go", "lers", "substring"},
+		{"api/handlers.go", "hdlr", "fuzzy"},
+		{"api/handlers.go", "api/hand", "prefix"},
+		{"api/handlers.go", `api\hand`, "prefix"},
+		{"web/handlers.go", "api/hand", ""},
+		{"api/handlers.go", "api/zzz", ""},
+		{"api/server/main.go", "apimain", "path"},
+		{"main.go", "xyz", ""},
+	}
+	for _, tt := range tests {
+		score, kind := scoreFile(tt.rel, tt.q)
+		if kind != tt.kind || (score > 0) != (tt.kind != "") {
+			t.Errorf("scoreFile(%q, %q) = %d, %q, want %q", tt.rel, tt.q, score, kind, tt.kind)
+		}
+	}
+
+	// The directory part only narrows the match; a scattered one costs a little
+	near, _ := scoreFile("api/handlers.go", "api/hand")
+	far, _ := scoreFile("a/p/i/handlers.go", "api/hand")
+	if far == 0 || far >= near {
+		t.Errorf("scattered directory scored %d, contiguous %d", far, near)
+	}
+}
+
+func TestFindFiles(t *testing.T) {
+	ws := t.TempDir()
+	for _, rel := range []string{"main.go", "handlers.go", "api/handlers.go", "node_modules/x/handlers.go", ".git/handlers"} {
+		writeTestFile(t, filepath.Join(ws, filepath.FromSlash(rel)), "")
+	}
+	saved := currentWorkDir
+	currentWorkDir = ws
+	invalidateFileList()
+	defer func() {
+		currentWorkDir = saved
+		invalidateFileList()
+	}()
+
+	find := func(q string) []string {
+		w := httptest.NewRecorder()
+		handleFindFiles(w, httptest.NewRequest("GET", "/api/fs/find?q="+q, nil))
+		var resp struct {
+			Results []FileMatch `json:"results"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %v: %s", q, err, w.Body)
+		}
+		var rels []string
+		for _, m := range resp.Results {
+			rels = append(rels, m.RelPath)
+		}
+		return rels
+	}
+
+	// Equal scores go to the shorter path; ignored directories never show up
+	if got := find("handlers"); len(got) != 2 || got[0] != "handlers.go" || got[1] != "api/handlers.go" {
+		t.Errorf("handlers: %q", got)
+	}
+	if got := find("api/h"); len(got) != 1 || got[0] != "api/handlers.go" {
+		t.Errorf("api/h: %q", got)
+	}
+
+	// New files show up once the list is invalidated
+	writeTestFile(t, filepath.Join(ws, "api", "handlers2.go"), "")
+	if got := find("handlers2"); len(got) != 0 {
+		t.Errorf("cached list changed by itself: %q", got)
+	}
+	invalidateFileList()
+	if got := find("handlers2"); len(got) != 1 {
+		t.Errorf("handlers2 after invalidation: %q", got)
+	}
+}
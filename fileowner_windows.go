@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+)
+
+// preserveOwner is a no-op on Windows, where a replaced file keeps the ACLs
+// inherited from its directory.
+func preserveOwner(path string, info fs.FileInfo) error {
+	return nil
+}
+
+// syncDir is a no-op on Windows; directories can't be opened for syncing.
+func syncDir(dir string) error {
+	return nil
+}
+
+// errorNotSameDevice is ERROR_NOT_SAME_DEVICE, which MoveFileEx returns for a
+// move to another volume.
+const errorNotSameDevice syscall.Errno = 17
+
+// isCrossDevice reports whether a rename failed because source and
+// destination are on different volumes.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
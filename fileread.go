@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxInlineFileSize = 5 << 20 // Larger text files are served in chunks
+	defaultChunkSize  = 1 << 20
+	maxChunkSize      = 8 << 20
+	hexPageSize       = 4 << 10
+	maxHexPageSize    = 64 << 10
+	sniffSize         = 8000
+)
+
+// FileChunk is the read response for binary files and for text files too
+// large to send whole. Binary files get a hex dump of the requested range
+// as Content; text chunks end on a character boundary, and NextOffset is
+// where the following chunk starts.
+type FileChunk struct {
+	Content    string    `json:"content"`
+	Encoding   string    `json:"encoding,omitempty"`
+	Binary     bool      `json:"binary"`
+	Partial    bool      `json:"partial"`
+	MimeType   string    `json:"mimeType"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"modTime"`
+	Offset     int64     `json:"offset"`
+	Length     int       `json:"length"`
+	NextOffset int64     `json:"nextOffset"`
+	More       bool      `json:"more"`
+}
+
+// isBinary guesses from the first bytes of a file whether it is binary:
+// NUL bytes (outside UTF-16) or a high share of control characters.
+func isBinary(head []byte) bool {
+	if bytes.HasPrefix(head, []byte{0xFF, 0xFE}) || bytes.HasPrefix(head, []byte{0xFE, 0xFF}) {
+		return false
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return true
+	}
+	ctrl := 0
+	for _, b := range head {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' && b != 0x1b {
+			ctrl++
+		}
+	}
+	return ctrl*10 > len(head)
+}
+
+// fileMimeType returns the Content-Type for a file by extension, falling
+// back to sniffing its first bytes.
+func fileMimeType(path string, head []byte) string {
+	if t := mime.TypeByExtension(filepath.Ext(path)); t != "" {
+		return t
+	}
+	return http.DetectContentType(head)
+}
+
+// readRange reads up to length bytes of path starting at offset.
+func readRange(path string, offset int64, length int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, length)
+	n, err := f.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// parseRange reads the offset and length query parameters, clamping the
+// length to (0, max].
+func parseRange(r *http.Request, defaultLength, max int) (int64, int, error) {
+	q := r.URL.Query()
+	var offset int64
+	length := defaultLength
+	if s := q.Get("offset"); s != "" {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || v < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q", s)
+		}
+		offset = v
+	}
+	if s := q.Get("length"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 {
+			return 0, 0, fmt.Errorf("invalid length %q", s)
+		}
+		length = min(v, max)
+	}
+	return offset, length, nil
+}
+
+// readChunk answers a read of a binary file or of a range of a large text
+// file. It reports false if the whole file should be read as usual instead.
+func readChunk(w http.ResponseWriter, r *http.Request, path string, info fs.FileInfo) bool {
+	head, err := readRange(path, 0, sniffSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	binary := isBinary(head)
+	ranged := r.URL.Query().Has("offset") || r.URL.Query().Has("length")
+	if !binary && !ranged && info.Size() <= maxInlineFileSize {
+		return false
+	}
+
+	chunk := FileChunk{
+		Binary:   binary,
+		Partial:  true,
+		MimeType: fileMimeType(path, head),
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+	}
+	defaultLength, max := defaultChunkSize, maxChunkSize
+	if binary {
+		defaultLength, max = hexPageSize, maxHexPageSize
+	}
+	offset, length, err := parseRange(r, defaultLength, max)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return true
+	}
+	data, err := readRange(path, offset, length)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	atEOF := offset+int64(len(data)) >= info.Size()
+
+	if binary {
+		chunk.Content = hexDump(data, offset)
+	} else {
+		chunk.Encoding = detectHeadEncoding(head, info.Size() > int64(len(head)))
+		if !atEOF {
+			data = trimPartialChar(data, chunk.Encoding)
+		}
+		chunk.Content = decodeChunk(data, chunk.Encoding, offset == 0)
+	}
+	chunk.Offset = offset
+	chunk.Length = len(data)
+	chunk.NextOffset = offset + int64(len(data))
+	chunk.More = chunk.NextOffset < info.Size()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chunk)
+	return true
+}
+
+// detectHeadEncoding is detectEncoding for the start of a file. If the file
+// goes on, head may end part way through a character, which must not make
+// it look invalid.
+func detectHeadEncoding(head []byte, truncated bool) string {
+	if !truncated {
+		return detectEncoding(head)
+	}
+	if enc := detectEncoding(trimPartialChar(head, encUTF8)); enc != encLatin1 {
+		return enc
+	}
+	return detectEncoding(trimPartialChar(head, encGBK))
+}
+
+// trimPartialChar drops a character cut off at the end of a chunk so it is
+// sent whole with the next one.
+func trimPartialChar(data []byte, enc string) []byte {
+	switch enc {
+	case encUTF16LE, encUTF16BE:
+		if len(data)%2 == 1 {
+			data = data[:len(data)-1]
+		}
+	case encUTF8, encUTF8BOM:
+		for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(data[i]) {
+				if !utf8.FullRune(data[i:]) {
+					data = data[:i]
+				}
+				break
+			}
+		}
+	case encGBK:
+		// A byte in 0x81-0xFE leads a two-byte character, but can also be
+		// a trail byte. Trail bytes outside that range end a character, so
+		// the trailing run of such bytes starts on a boundary and pairs up;
+		// an odd run ends with a lead whose trail is in the next chunk.
+		run := 0
+		for i := len(data) - 1; i >= 0 && data[i] >= 0x81 && data[i] <= 0xFE; i-- {
+			run++
+		}
+		if run%2 == 1 {
+			data = data[:len(data)-1]
+		}
+	}
+	return data
+}
+
+// decodeChunk decodes part of a file. Only the first chunk carries the BOM,
+// so later UTF-16 chunks get it added back for the decoder.
+func decodeChunk(data []byte, enc string, first bool) string {
+	if !first {
+		switch enc {
+		case encUTF8BOM:
+			enc = encUTF8
+		case encUTF16LE:
+			data = append([]byte{0xFF, 0xFE}, data...)
+		case encUTF16BE:
+			data = append([]byte{0xFE, 0xFF}, data...)
+		}
+	}
+	text, err := decodeText(data, enc)
+	if err != nil {
+		return string(data)
+	}
+	return text
+}
+
+// hexDump formats data like hexdump -C, numbering from offset.
+func hexDump(data []byte, offset int64) string {
+	var sb strings.Builder
+	for i := 0; i < len(data); i += 16 {
+		line := data[i:min(i+16, len(data))]
+		fmt.Fprintf(&sb, "%08x  ", offset+int64(i))
+		for j := 0; j < 16; j++ {
+			if j < len(line) {
+				fmt.Fprintf(&sb, "%02x ", line[j])
+			} else {
+				sb.WriteString("   ")
+			}
+			if j == 7 {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(" |")
+		for _, b := range line {
+			if b < 0x20 || b > 0x7e {
+				b = '.'
+			}
+			sb.WriteByte(b)
+		}
+		sb.WriteString("|\n")
+	}
+	return sb.String()
+}
+
+// handleRawFile serves a file's bytes with its Content-Type, supporting
+// Range requests, for images and downloads. Only images are shown inline;
+// everything runs under a sandbox CSP so served HTML or SVG can't script
+// the editor's origin.
+func handleRawFile(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	path, ok := checkWorkspacePath(w, r, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if info.IsDir() {
+		http.Error(w, "Path is a directory", http.StatusBadRequest)
+		return
+	}
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	mimeType := fileMimeType(path, head[:n])
+
+	disposition := "attachment"
+	if strings.HasPrefix(mimeType, "image/") && r.URL.Query().Get("download") == "" {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": info.Name()}))
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTrimPartialChar cuts encoded text at every byte and checks that the
+// trimmed chunk and the rest both decode back to the original text.
+func TestTrimPartialChar(t *testing.T) {
+	// 丂 is 0x81 0x40 in GBK, a trail byte in the ASCII range
+	text := "a中文丂@b 编辑器\n丂丂x"
+	for _, enc := range []string{encUTF8, encUTF16LE, encUTF16BE, encGBK} {
+		data, err := encodeText(text, enc)
+		if err != nil {
+			t.Fatalf("%s: %v", enc, err)
+		}
+		if enc == encUTF16LE || enc == encUTF16BE {
+			data = data[2:] // Chunks after the first carry no BOM
+		}
+		for cut := 0; cut <= len(data); cut++ {
+			chunk := trimPartialChar(data[:cut], enc)
+			if cut-len(chunk) > 1 && enc != encUTF8 {
+				t.Errorf("%s: cut at %d dropped %d bytes", enc, cut, cut-len(chunk))
+			}
+			got := decodeChunk(chunk, enc, false) + decodeChunk(data[len(chunk):], enc, false)
+			if got != text {
+				t.Errorf("%s: cut at %d decodes to %q, want %q", enc, cut, got, text)
+			}
+		}
+	}
+}
+
+// TestReadChunkSniffBoundary reads a large file whose first sniffSize bytes
+// end inside a character; it must still be detected as what it is.
+func TestReadChunkSniffBoundary(t *testing.T) {
+	for _, tt := range []struct {
+		enc  string
+		char string
+	}{
+		{encUTF8, "中"},
+		{encGBK, "中"},
+	} {
+		char, err := encodeText(tt.char, tt.enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// One whole character first, as an all-ASCII head says nothing
+		for pad := sniffSize - 2*len(char) + 1; pad < sniffSize-len(char); pad++ {
+			text := tt.char + strings.Repeat("a", pad) + strings.Repeat(tt.char, 100)
+			data, err := encodeText(text, tt.enc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "big.txt")
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			info, _ := os.Stat(path)
+
+			rec := httptest.NewRecorder()
+			if !readChunk(rec, httptest.NewRequest("GET", "/api/fs/read?offset=0", nil), path, info) {
+				t.Fatal("readChunk declined a ranged read")
+			}
+			var chunk FileChunk
+			if err := json.Unmarshal(rec.Body.Bytes(), &chunk); err != nil {
+				t.Fatal(err)
+			}
+			if chunk.Encoding != tt.enc || chunk.Content != text {
+				t.Errorf("%s with %d bytes of padding: read as %s", tt.enc, pad, chunk.Encoding)
+			}
+		}
+	}
+}
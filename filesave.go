@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileVersion identifies the on-disk state of a file the client has seen.
+// It is sent as "<mtime in ns>:<content hash>"; only the hash decides
+// whether a save is stale, so touching a file doesn't cause a conflict.
+type fileVersion struct {
+	ModTime int64
+	Hash    string
+}
+
+func (v fileVersion) String() string {
+	return fmt.Sprintf("%d:%s", v.ModTime, v.Hash)
+}
+
+var errInvalidVersion = errors.New("invalid version")
+
+func parseFileVersion(s string) (fileVersion, error) {
+	var v fileVersion
+	mtime, hash, ok := strings.Cut(s, ":")
+	if !ok || hash == "" {
+		return v, fmt.Errorf("%w %q", errInvalidVersion, s)
+	}
+	if _, err := fmt.Sscan(mtime, &v.ModTime); err != nil {
+		return v, fmt.Errorf("%w %q", errInvalidVersion, s)
+	}
+	v.Hash = hash
+	return v, nil
+}
+
+func versionOf(info fs.FileInfo, content []byte) fileVersion {
+	sum := sha256.Sum256(content)
+	return fileVersion{ModTime: info.ModTime().UnixNano(), Hash: hex.EncodeToString(sum[:16])}
+}
+
+// readVersioned reads a file and its version.
+func readVersioned(path string) ([]byte, fileVersion, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fileVersion{}, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fileVersion{}, err
+	}
+	return content, versionOf(info, content), nil
+}
+
+// conflictError reports a save based on a version that is no longer on disk.
+type conflictError struct {
+	Path    string
+	Current fileVersion
+	Content []byte
+	Deleted bool
+}
+
+func (e *conflictError) Error() string {
+	return "file changed on disk since it was read: " + e.Path
+}
+
+// saveWorkspaceFile writes text to path unless the file changed on disk
+// since the client read expectedVersion. An empty expectedVersion skips the
+// check. The text is encoded as enc, or when enc is empty in the encoding of
+// the existing file (UTF-8 for new files). Existing files keep their line
+// ending policy (see matchLineEndings), mode and owner, and are replaced
+// atomically; their previous content goes to the local history. It returns
+// the version of the written file.
+func saveWorkspaceFile(path string, text string, enc string, expectedVersion string) (fileVersion, error) {
+	path, current, exists, err := readForSave(path, expectedVersion)
+	if err != nil {
+		return fileVersion{}, err
+	}
+
+	content := []byte(text)
+	if exists {
+		origText, origEnc := decodeFile(current)
+		if enc == "" {
+			enc = origEnc
+		}
+		content = matchLineEndings([]byte(origText), content)
+	}
+	if enc == "" {
+		enc = encUTF8
+	}
+	content, err = encodeText(string(content), enc)
+	if err != nil {
+		return fileVersion{}, err
+	}
+	return replaceSaved(path, current, exists, content)
+}
+
+// writeWorkspaceBytes is saveWorkspaceFile for content that must reach the
+// disk byte for byte, such as a history snapshot: it is neither re-encoded
+// nor given the file's line endings.
+func writeWorkspaceBytes(path string, content []byte, expectedVersion string) (fileVersion, error) {
+	path, current, exists, err := readForSave(path, expectedVersion)
+	if err != nil {
+		return fileVersion{}, err
+	}
+	return replaceSaved(path, current, exists, content)
+}
+
+// readForSave resolves symlinks in path, so saves write through them
+// instead of replacing them with a regular file, and reads the current
+// content, checking it against expectedVersion if that isn't empty.
+func readForSave(path string, expectedVersion string) (string, []byte, bool, error) {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	current, currentVersion, err := readVersioned(path)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", nil, false, err
+	}
+
+	if expectedVersion != "" {
+		expected, err := parseFileVersion(expectedVersion)
+		if err != nil {
+			return "", nil, false, err
+		}
+		if !exists {
+			return "", nil, false, &conflictError{Path: path, Deleted: true}
+		}
+		if currentVersion.Hash != expected.Hash {
+			return "", nil, false, &conflictError{Path: path, Current: currentVersion, Content: current}
+		}
+	}
+	return path, current, exists, nil
+}
+
+// replaceSaved snapshots the current content of an existing file if it
+// differs from content, then writes content atomically.
+func replaceSaved(path string, current []byte, exists bool, content []byte) (fileVersion, error) {
+	if exists && !bytes.Equal(current, content) {
+		if err := snapshotFile(path, current); err != nil {
+			log.Printf("Failed to snapshot %s: %v\n", path, err)
+		}
+	}
+	info, err := writeFileAtomic(path, content)
+	if err != nil {
+		return fileVersion{}, err
+	}
+	return versionOf(info, content), nil
+}
+
+// matchLineEndings keeps orig's line ending policy in content: CRLF line
+// endings if orig uses nothing else, and orig's final newline state, so a
+// final newline is added if orig ended with one and dropped if it didn't.
+// Without any line break in orig there is no policy to keep.
+func matchLineEndings(orig, content []byte) []byte {
+	lines := bytes.Count(orig, []byte("\n"))
+	if lines == 0 || len(content) == 0 {
+		return content
+	}
+	out := content
+	if bytes.Count(orig, []byte("\r\n")) == lines {
+		out = bytes.ReplaceAll(out, []byte("\r\n"), []byte("\n"))
+		out = bytes.ReplaceAll(out, []byte("\n"), []byte("\r\n"))
+	}
+
+	switch {
+	case bytes.HasSuffix(orig, []byte("\n")) && !bytes.HasSuffix(out, []byte("\n")):
+		final := []byte("\n")
+		if bytes.HasSuffix(orig, []byte("\r\n")) {
+			final = []byte("\r\n")
+		}
+		out = append(out[:len(out):len(out)], final...)
+	case !bytes.HasSuffix(orig, []byte("\n")) && bytes.HasSuffix(out, []byte("\n")):
+		out = bytes.TrimSuffix(out, []byte("\n"))
+		out = bytes.TrimSuffix(out, []byte("\r"))
+	}
+	return out
+}
+
+// writeFileAtomic replaces path with data via a synced temp file in the same
+// directory and a rename, so readers never see a half-written file. An
+// existing file's permissions and owner carry over.
+func writeFileAtomic(path string, data []byte) (fs.FileInfo, error) {
+	dir := filepath.Dir(path)
+	mode := fs.FileMode(0644)
+	orig, statErr := os.Stat(path)
+	if statErr == nil {
+		mode = orig.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return nil, err
+	}
+	tmpName := tmp.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			os.Remove(tmpName)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmpName, mode); err != nil {
+		return nil, err
+	}
+	if statErr == nil {
+		if err := preserveOwner(tmpName, orig); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return nil, err
+	}
+	committed = true
+	syncDir(dir)
+
+	return os.Stat(path)
+}
+
+// writeSaveError answers a failed save: 409 with the current disk content
+// for conflicts, so the client can merge, 400 for bad versions or content
+// the encoding can't hold, and 500 otherwise.
+func writeSaveError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidVersion) || errors.Is(err, errEncoding) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var conflict *conflictError
+	if !errors.As(err, &conflict) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	resp := map[string]interface{}{
+		"error":   conflict.Error(),
+		"type":    "conflict",
+		"path":    conflict.Path,
+		"deleted": conflict.Deleted,
+	}
+	if !conflict.Deleted {
+		resp["version"] = conflict.Current.String()
+		resp["content"], resp["encoding"] = decodeFile(conflict.Content)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
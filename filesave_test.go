@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteWorkspaceBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.txt")
+	if err := os.WriteFile(path, []byte("one\r\ntwo\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, version, err := readVersioned(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mixed line endings, no final newline and invalid UTF-8 all survive
+	want := []byte("a\nb\r\nc\xff")
+	if _, err := writeWorkspaceBytes(path, want, version.String()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, want) {
+		t.Errorf("file = %q, want %q", got, want)
+	}
+
+	var conflict *conflictError
+	if _, err := writeWorkspaceBytes(path, []byte("x"), version.String()); !errors.As(err, &conflict) {
+		t.Errorf("write with a stale version: err = %v, want a conflict", err)
+	}
+}
+
+func TestMatchLineEndings(t *testing.T) {
+	tests := []struct {
+		orig, content, want string
+	}{
+		{"a\nb\n", "a\nb", "a\nb\n"}, // The file ends with a newline, so it keeps one
+		{"a\nb\n", "a\nb\n", "a\nb\n"},
+		{"a\nb", "a\nb\n", "a\nb"}, // And one without keeps having none
+		{"a\nb", "a\nb", "a\nb"},
+		{"a\r\nb\r\n", "a\nb\nc", "a\r\nb\r\nc\r\n"},
+		{"a\r\nb\r\n", "a\r\nb\nc\n", "a\r\nb\r\nc\r\n"},
+		{"a\r\nb", "a\nb\r\n", "a\r\nb"},
+		{"a\r\nb\nc\r\n", "a\nb\r\nc", "a\nb\r\nc\r\n"}, // Mixed line endings are left alone
+		{"a\nb\n", "a\r\nb\n", "a\r\nb\n"},
+		{"a", "a\nb\n", "a\nb\n"}, // No line break, no policy
+		{"", "a\nb", "a\nb"},
+		{"a\n", "", ""},
+	}
+	for _, tt := range tests {
+		if got := string(matchLineEndings([]byte(tt.orig), []byte(tt.content))); got != tt.want {
+			t.Errorf("matchLineEndings(%q, %q) = %q, want %q", tt.orig, tt.content, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	maxListDepth = 8
+	maxListNodes = 20000 // Per request, so a deep listing can't run away
+)
+
+// dirLister builds FileNode trees for one /api/fs/list request.
+type dirLister struct {
+	ignore *ignoreEngine
+	git    map[string]string
+	less   func(a, b *FileNode) bool
+	count  int
+}
+
+// list returns the entries of dir, descending depth-1 more levels into
+// subdirectories. Symlinked directories are listed but not descended into.
+func (l *dirLister) list(dir string, depth int) ([]FileNode, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []FileNode{}
+	for _, e := range entries {
+		if l.count >= maxListNodes {
+			break
+		}
+		path := filepath.Join(dir, e.Name())
+		node := FileNode{Name: e.Name(), Path: path, GitStatus: l.git[path]}
+
+		info, err := e.Info()
+		if err != nil {
+			continue // Removed while listing
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			node.Symlink, _ = os.Readlink(path)
+			if target, err := os.Stat(path); err == nil {
+				info = target // Describe what the link points to
+			}
+		}
+		node.IsDir = info.IsDir()
+		node.Size = info.Size()
+		node.ModTime = info.ModTime()
+		node.Mode = info.Mode().String()
+		if l.ignore.ignored(path, node.IsDir) {
+			continue
+		}
+		l.count++
+
+		if node.IsDir {
+			node.Size = 0
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				node.HasGoMod = true
+			}
+			if depth > 1 && node.Symlink == "" {
+				node.Children, _ = l.list(path, depth-1)
+			}
+		}
+		nodes = append(nodes, node)
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool { return l.less(&nodes[i], &nodes[j]) })
+	return nodes, nil
+}
+
+// fileNodeLess returns the ordering for a sort key: "name" (default),
+// "type" (extension), "size" or "mtime". Directories always come first.
+func fileNodeLess(key string, desc bool) func(a, b *FileNode) bool {
+	byName := func(a, b *FileNode) int {
+		if c := strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	}
+	compare := byName
+	switch key {
+	case "type":
+		compare = func(a, b *FileNode) int {
+			if c := strings.Compare(strings.ToLower(filepath.Ext(a.Name)), strings.ToLower(filepath.Ext(b.Name))); c != 0 {
+				return c
+			}
+			return byName(a, b)
+		}
+	case "size":
+		compare = func(a, b *FileNode) int {
+			if a.Size != b.Size {
+				if a.Size < b.Size {
+					return -1
+				}
+				return 1
+			}
+			return byName(a, b)
+		}
+	case "mtime":
+		compare = func(a, b *FileNode) int {
+			if c := a.ModTime.Compare(b.ModTime); c != 0 {
+				return c
+			}
+			return byName(a, b)
+		}
+	}
+
+	return func(a, b *FileNode) bool {
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		if desc {
+			return compare(a, b) > 0
+		}
+		return compare(a, b) < 0
+	}
+}
@@ -86,6 +86,15 @@ function App() {
 
   const editorRef = useRef<any>(null);
   const pendingJumpRef = useRef<{ path: string; selection: any } | null>(null);
+  // Disk version of each open file as last read or saved, sent back on save
+  // so the server can reject saves that would clobber external edits
+  const fileVersionsRef = useRef<Record<string, string>>({});
+  // Binary files (hex dump) and chunks of large files can be viewed but not saved
+  const [isReadOnly, setIsReadOnly] = useState(false);
+  // Bumped on file creations/deletions pushed by the server, to refresh the tree
+  const [fsChangeCount, setFsChangeCount] = useState(0);
+  const currentFileRef = useRef<string | null>(null);
+  currentFileRef.current = currentFile;
 
   useEffect(() => {
     localStorage.setItem('go_editor_config', JSON.stringify(config));
@@ -100,6 +109,35 @@ function App() {
     return () => window.removeEventListener('beforeunload', handleUnload);
   }, []);
 
+  // File changes pushed by the server (/api/events)
+  useEffect(() => {
+    const source = new EventSource('http://localhost:8080/api/events', { withCredentials: true });
+    source.addEventListener('files', async (e) => {
+      const events: { type: string; path: string; isDir: boolean }[] = JSON.parse((e as MessageEvent).data);
+      if (events.some(ev => ev.type !== 'modified')) {
+        setFsChangeCount(n => n + 1);
+      }
+
+      const open = currentFileRef.current;
+      const change = open && events.find(ev => ev.path.replace(/\\/g, '/') === open);
+      if (!change) return;
+      if (change.type === 'deleted') {
+        setConsoleOutput(`${open} was deleted on disk.`);
+        return;
+      }
+      // Our own saves also show up here; only report other programs' changes
+      try {
+        const resp = await axios.get('http://localhost:8080/api/fs/read', { params: { path: open } });
+        if (resp.data.version && resp.data.version !== fileVersionsRef.current[open]) {
+          setConsoleOutput(`${open} was changed on disk by another program. Reopen it to load the new version.`);
+        }
+      } catch (err) {
+        console.error('[App] Failed to check changed file:', err);
+      }
+    });
+    return () => source.close();
+  }, []);
+
   // Handle pending jumps (e.g. from Go to Definition across files)
   useEffect(() => {
     if (pendingJumpRef.current && currentFile) {
@@ -411,11 +449,19 @@ function App() {
 
       if (resp.data && typeof resp.data.content === 'string') {
         const content = resp.data.content;
+        fileVersionsRef.current[path.replace(/\\/g, '/')] = resp.data.version;
+        setIsReadOnly(!!resp.data.partial);
         // Important: Set current file first so Editor key updates
         setCurrentFile(path.replace(/\\/g, '/'));
         // Then set code
         setCode(content);
-        setConsoleOutput(`Loaded: ${path} (${content.length} chars)`);
+        if (resp.data.binary) {
+          setConsoleOutput(`Loaded: ${path} (binary, ${resp.data.size} bytes, ${resp.data.mimeType}) - showing a read-only hex dump`);
+        } else if (resp.data.partial) {
+          setConsoleOutput(`Loaded: ${path} (first ${resp.data.length} of ${resp.data.size} bytes) - large file, read-only`);
+        } else {
+          setConsoleOutput(`Loaded: ${path} (${content.length} chars)`);
+        }
         console.log('[App] State updated for:', path);
       } else {
         setConsoleOutput(`Error: Invalid response format from server for ${path}`);
@@ -432,32 +478,54 @@ function App() {
       alert('No file is currently open');
       return;
     }
+    if (isReadOnly) {
+      alert('This file is binary or too large to edit here and is shown read-only.');
+      return;
+    }
     try {
-      await axios.post('http://localhost:8080/api/fs/save', {
+      const resp = await axios.post('http://localhost:8080/api/fs/save', {
         path: currentFile,
-        content: code
+        content: code,
+        version: fileVersionsRef.current[currentFile]
       });
+      fileVersionsRef.current[currentFile] = resp.data.version;
       alert('File saved successfully!');
     } catch (e: any) {
+      if (e.response?.status === 409) {
+        alert('The file was changed on disk by another program. Reopen it to see the latest version before saving.');
+        return;
+      }
       alert('Failed to save file: ' + e.message);
     }
   };
 
   const runCode = async () => {
+    if (isReadOnly) {
+      setConsoleOutput('Not run: this file is shown read-only.');
+      return;
+    }
     setIsRunning(true);
     setConsoleOutput('Running...');
     try {
       const response = await axios.post('http://localhost:8080/api/run', {
         code,
         path: currentFile,
+        version: currentFile ? fileVersionsRef.current[currentFile] : undefined,
         env: config
       });
+      if (currentFile && response.data.version) {
+        fileVersionsRef.current[currentFile] = response.data.version;
+      }
       if (response.data.error) {
         setConsoleOutput('Error:\n' + response.data.error + '\n\nOutput:\n' + response.data.output);
       } else {
         setConsoleOutput(response.data.output);
       }
     } catch (error: any) {
+      if (error.response?.status === 409) {
+        setConsoleOutput('Not run: the file was changed on disk by another program. Reopen it before running.');
+        return;
+      }
       setConsoleOutput('Failed to execute: ' + error.message);
     } finally {
       setIsRunning(false);
@@ -600,7 +668,7 @@ function App() {
             position="left"
             className="border-r border-[#334155]"
           >
-            <FileExplorer onFileSelect={handleFileSelect} currentPath={currentFile || undefined} />
+            <FileExplorer onFileSelect={handleFileSelect} currentPath={currentFile || undefined} changeCount={fsChangeCount} />
           </ResizablePanel>
         )}
 
@@ -622,6 +690,7 @@ function App() {
                 padding: { top: 20 },
                 scrollBeyondLastLine: false,
                 automaticLayout: true,
+                readOnly: isReadOnly,
               }}
             />
           </div>
@@ -6,12 +6,27 @@ interface FileNode {
     name: string;
     path: string;
     isDir: boolean;
+    size: number;
+    mtime: string;
+    mode: string;
+    symlink?: string;
+    gitStatus?: string; // M, A, D, R, C, U (conflict), ? (untracked)
+    hasGoMod?: boolean;
     children?: FileNode[]; // loaded dynamically
 }
 
+const gitStatusColors: Record<string, string> = {
+    M: 'text-yellow-400',
+    A: 'text-green-400',
+    '?': 'text-green-400',
+    D: 'text-red-400',
+    U: 'text-red-500',
+};
+
 interface FileExplorerProps {
     onFileSelect: (path: string) => void;
     currentPath?: string; // Highlight current file
+    changeCount?: number; // Bumped when files are created or deleted on disk
 }
 
 const FileTreeItem: React.FC<{
@@ -19,28 +34,35 @@ const FileTreeItem: React.FC<{
     onSelect: (path: string) => void;
     level: number;
     currentPath?: string;
-}> = ({ node, onSelect, level, currentPath }) => {
+    changeCount?: number;
+}> = ({ node, onSelect, level, currentPath, changeCount }) => {
     const [isOpen, setIsOpen] = useState(false);
     const [children, setChildren] = useState<FileNode[]>([]);
     const [isLoading, setIsLoading] = useState(false);
 
+    // Reload open folders when files change on disk
+    useEffect(() => {
+        if (isOpen) {
+            loadChildren();
+        }
+    }, [changeCount]);
+
     const fetchChildren = async () => {
         if (children.length > 0) {
             setIsOpen(!isOpen);
             return;
         }
+        loadChildren();
+    };
 
+    const loadChildren = async () => {
         setIsLoading(true);
         try {
+            // The server sorts: folders first, then by name
             const resp = await axios.get('http://localhost:8080/api/fs/list', {
                 params: { path: node.path }
             });
-            // safe sort: folders first
-            const sorted = resp.data.sort((a: FileNode, b: FileNode) => {
-                if (a.isDir === b.isDir) return a.name.localeCompare(b.name);
-                return a.isDir ? -1 : 1;
-            });
-            setChildren(sorted);
+            setChildren(resp.data || []);
             setIsOpen(true);
         } catch (e) {
             console.error("Failed to list dir", e);
@@ -81,9 +103,17 @@ const FileTreeItem: React.FC<{
                     <FileCode size={16} className="text-gray-400" />
                 )}
 
-                <span className={`text-sm truncate ${node.path === currentPath ? 'text-white font-medium' : 'text-gray-300'}`}>
+                <span
+                    className={`text-sm truncate ${node.path === currentPath ? 'text-white font-medium' : 'text-gray-300'}`}
+                    title={node.symlink ? `${node.name} → ${node.symlink}` : node.name}
+                >
                     {node.name}
                 </span>
+                {node.gitStatus && (
+                    <span className={`ml-auto pr-1 text-xs font-mono ${gitStatusColors[node.gitStatus] || 'text-gray-400'}`}>
+                        {node.gitStatus}
+                    </span>
+                )}
             </div>
 
             {isOpen && (
@@ -96,6 +126,7 @@ const FileTreeItem: React.FC<{
                             level={level + 1}
                             onSelect={onSelect}
                             currentPath={currentPath}
+                            changeCount={changeCount}
                         />
                     ))}
                 </div>
@@ -104,7 +135,7 @@ const FileTreeItem: React.FC<{
     );
 };
 
-export const FileExplorer: React.FC<FileExplorerProps> = ({ onFileSelect, currentPath }) => {
+export const FileExplorer: React.FC<FileExplorerProps> = ({ onFileSelect, currentPath, changeCount }) => {
     const [roots, setRoots] = useState<FileNode[]>([]);
     const [loading, setLoading] = useState(false);
 
@@ -113,12 +144,7 @@ export const FileExplorer: React.FC<FileExplorerProps> = ({ onFileSelect, curren
         setLoading(true);
         try {
             const resp = await axios.get('http://localhost:8080/api/fs/list');
-            // Sort folders first
-            const sorted = resp.data.sort((a: FileNode, b: FileNode) => {
-                if (a.isDir === b.isDir) return a.name.localeCompare(b.name);
-                return a.isDir ? -1 : 1;
-            });
-            setRoots(sorted);
+            setRoots(resp.data || []);
         } catch (e) {
             console.error("Failed to load root", e);
         } finally {
@@ -139,7 +165,7 @@ export const FileExplorer: React.FC<FileExplorerProps> = ({ onFileSelect, curren
 
     useEffect(() => {
         refresh();
-    }, []);
+    }, [changeCount]);
 
     return (
         <div className="flex flex-col h-full bg-[#161925]">
@@ -181,6 +207,7 @@ export const FileExplorer: React.FC<FileExplorerProps> = ({ onFileSelect, curren
                             level={0}
                             onSelect={onFileSelect}
                             currentPath={currentPath}
+                            changeCount={changeCount}
                         />
                     ))
                 )}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// dataDirName is the per-workspace directory holding editor data such as the
+// trash. It is hidden, so the tree and the indexer skip it, and it ignores
+// itself for git.
+const dataDirName = ".gofast"
+
+// workspaceDataDir returns (creating it if needed) a subdirectory of the
+// workspace's editor data directory.
+func workspaceDataDir(kind string) (string, error) {
+	if currentWorkDir == "" {
+		return "", errors.New("no workspace directory set")
+	}
+	base := filepath.Join(currentWorkDir, dataDirName)
+	dir := filepath.Join(base, kind)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	ignore := filepath.Join(base, ".gitignore")
+	if _, err := os.Stat(ignore); os.IsNotExist(err) {
+		os.WriteFile(ignore, []byte("*\n"), 0644)
+	}
+	return dir, nil
+}
+
+// decodeFsRequest decodes a JSON body and resolves each named path field
+// against the workspace, writing an error response on failure.
+func decodeFsRequest(w http.ResponseWriter, r *http.Request, req interface{}, paths ...*string) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	for _, p := range paths {
+		resolved, ok := checkWorkspacePath(w, r, *p)
+		if !ok {
+			return false
+		}
+		*p = resolved
+	}
+	return true
+}
+
+// isWorkspaceRoot reports whether p is one of the workspace roots, which the
+// fs endpoints must never move or delete.
+func isWorkspaceRoot(p string) bool {
+	for _, root := range workspaceRoots() {
+		if abs, err := filepath.Abs(root); err == nil && sameFile(abs, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeFsOK(w http.ResponseWriter, fields map[string]string) {
+	fields["status"] = "ok"
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fields)
+}
+
+func handleCreateFile(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	var req struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+	}
+	if !decodeFsRequest(w, r, &req, &req.Path) {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(req.Path), 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	f, err := os.OpenFile(req.Path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			http.Error(w, "File already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = f.WriteString(req.Content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	invalidateFileList()
+	go updateIndexPaths(currentWorkDir, req.Path)
+	writeFsOK(w, map[string]string{"path": req.Path})
+}
+
+func handleMkdir(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	var req struct {
+		Path string `json:"path"`
+	}
+	if !decodeFsRequest(w, r, &req, &req.Path) {
+		return
+	}
+
+	if info, err := os.Stat(req.Path); err == nil {
+		if !info.IsDir() {
+			http.Error(w, "A file with that name already exists", http.StatusConflict)
+			return
+		}
+	} else if err := os.MkdirAll(req.Path, 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeFsOK(w, map[string]string{"path": req.Path})
+}
+
+// handleRename renames or moves a file or directory. The destination must
+// not exist; missing parent directories are created.
+func handleRename(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if !decodeFsRequest(w, r, &req, &req.From, &req.To) {
+		return
+	}
+	if !checkMoveSource(w, req.From, req.To) {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(req.To), 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := moveTree(req.From, req.To); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	invalidateFileList()
+	go updateIndexPaths(currentWorkDir, req.From, req.To)
+	writeFsOK(w, map[string]string{"from": req.From, "path": req.To})
+}
+
+func handleCopy(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if !decodeFsRequest(w, r, &req, &req.From, &req.To) {
+		return
+	}
+	if !checkMoveSource(w, req.From, req.To) {
+		return
+	}
+
+	if err := copyTree(req.From, req.To); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	invalidateFileList()
+	go updateIndexPaths(currentWorkDir, req.To)
+	writeFsOK(w, map[string]string{"from": req.From, "path": req.To})
+}
+
+// checkMoveSource validates a rename or copy: the source exists and is not a
+// workspace root, and the destination is free and not inside the source.
+func checkMoveSource(w http.ResponseWriter, from, to string) bool {
+	if _, err := os.Lstat(from); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return false
+	}
+	if isWorkspaceRoot(from) {
+		http.Error(w, "Cannot move a workspace root", http.StatusBadRequest)
+		return false
+	}
+	if pathWithin(from, to) {
+		http.Error(w, "Destination is inside the source", http.StatusBadRequest)
+		return false
+	}
+	if _, err := os.Lstat(to); err == nil {
+		http.Error(w, "Destination already exists", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// moveTree renames from to to. Across volumes, e.g. from an allowed root on
+// another drive into the workspace trash, it copies and then removes from.
+func moveTree(from, to string) error {
+	err := os.Rename(from, to)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+	if err := copyTree(from, to); err != nil {
+		os.RemoveAll(to)
+		return err
+	}
+	return os.RemoveAll(from)
+}
+
+// copyTree copies a file or directory recursively, keeping file modes.
+// Symlinks are recreated rather than followed.
+func copyTree(from, to string) error {
+	return filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(from, to string, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// trashEntry is written next to each trashed item so it can be restored by hand.
+type trashEntry struct {
+	OriginalPath string    `json:"originalPath"`
+	DeletedAt    time.Time `json:"deletedAt"`
+}
+
+// handleDelete moves a file or directory into the workspace trash
+// (.gofast/trash). Deleting something already in the trash removes it for good.
+func handleDelete(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	var req struct {
+		Path string `json:"path"`
+	}
+	if !decodeFsRequest(w, r, &req, &req.Path) {
+		return
+	}
+	if _, err := os.Lstat(req.Path); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if isWorkspaceRoot(req.Path) {
+		http.Error(w, "Cannot delete a workspace root", http.StatusBadRequest)
+		return
+	}
+
+	trash, err := workspaceDataDir("trash")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if pathWithin(trash, req.Path) {
+		if err := os.RemoveAll(req.Path); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeFsOK(w, map[string]string{"path": req.Path})
+		return
+	}
+
+	now := time.Now()
+	id := fmt.Sprintf("%s-%d", now.Format("20060102-150405"), now.Nanosecond())
+	dest := filepath.Join(trash, id, filepath.Base(req.Path))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := moveTree(req.Path, dest); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entry, _ := json.MarshalIndent(trashEntry{OriginalPath: req.Path, DeletedAt: now}, "", "  ")
+	os.WriteFile(filepath.Join(trash, id+".json"), entry, 0644)
+
+	invalidateFileList()
+	go updateIndexPaths(currentWorkDir, req.Path)
+	writeFsOK(w, map[string]string{"path": req.Path, "trashPath": dest})
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func fsRequest(t *testing.T, handler http.HandlerFunc, body interface{}) *httptest.ResponseRecorder {
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/api/fs", bytes.NewReader(data)))
+	return w
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenameOverExisting(t *testing.T) {
+	ws := t.TempDir()
+	saved := currentWorkDir
+	currentWorkDir = ws
+	defer func() { currentWorkDir = saved }()
+
+	a, b := filepath.Join(ws, "a.go"), filepath.Join(ws, "b.go")
+	writeTestFile(t, a, "package a\n")
+	writeTestFile(t, b, "package b\n")
+	writeTestFile(t, filepath.Join(ws, "dir", "c.go"), "package c\n")
+
+	tests := []struct {
+		name     string
+		from, to string
+		want     int
+	}{
+		{"onto a file", a, b, http.StatusConflict},
+		{"onto a directory", a, filepath.Join(ws, "dir"), http.StatusConflict},
+		{"into itself", filepath.Join(ws, "dir"), filepath.Join(ws, "dir", "sub"), http.StatusBadRequest},
+		{"workspace root", ws, filepath.Join(ws, "x"), http.StatusBadRequest},
+		{"missing source", filepath.Join(ws, "none.go"), filepath.Join(ws, "x.go"), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := fsRequest(t, handleRename, map[string]string{"from": tt.from, "to": tt.to})
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+	for path, want := range map[string]string{a: "package a\n", b: "package b\n"} {
+		if data, err := os.ReadFile(path); err != nil || string(data) != want {
+			t.Errorf("%s changed: %q, %v", path, data, err)
+		}
+	}
+
+	to := filepath.Join(ws, "new", "moved.go")
+	if w := fsRequest(t, handleRename, map[string]string{"from": a, "to": to}); w.Code != http.StatusOK {
+		t.Fatalf("rename: status %d: %s", w.Code, w.Body)
+	}
+	if _, err := os.Stat(a); !os.IsNotExist(err) {
+		t.Errorf("source still there: %v", err)
+	}
+	if data, _ := os.ReadFile(to); string(data) != "package a\n" {
+		t.Errorf("moved content %q", data)
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	base := t.TempDir()
+	from := filepath.Join(base, "from")
+	writeTestFile(t, filepath.Join(from, "a.txt"), "a")
+	writeTestFile(t, filepath.Join(from, "sub", "b.txt"), "b")
+	if err := os.Chmod(filepath.Join(from, "sub", "b.txt"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(from, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	hasLinks := os.Symlink("sub/b.txt", filepath.Join(from, "link")) == nil
+
+	to := filepath.Join(base, "to")
+	if err := copyTree(from, to); err != nil {
+		t.Fatal(err)
+	}
+	for rel, want := range map[string]string{"a.txt": "a", filepath.Join("sub", "b.txt"): "b"} {
+		if data, err := os.ReadFile(filepath.Join(to, rel)); err != nil || string(data) != want {
+			t.Errorf("%s: %q, %v", rel, data, err)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(to, "empty")); err != nil || !info.IsDir() {
+		t.Errorf("empty directory not copied: %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(filepath.Join(to, "sub", "b.txt")); err != nil || info.Mode().Perm() != 0755 {
+			t.Errorf("mode not kept: %v, %v", info.Mode(), err)
+		}
+	}
+	if hasLinks {
+		if link, err := os.Readlink(filepath.Join(to, "link")); err != nil || link != "sub/b.txt" {
+			t.Errorf("symlink not recreated: %q, %v", link, err)
+		}
+	}
+
+	// A single file copies too, and an existing destination is never overwritten
+	if err := copyTree(filepath.Join(from, "a.txt"), filepath.Join(base, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyTree(filepath.Join(from, "a.txt"), filepath.Join(to, "sub", "b.txt")); err == nil {
+		t.Error("copy over an existing file succeeded")
+	}
+}
+
+func TestDeleteMovesToTrash(t *testing.T) {
+	ws := t.TempDir()
+	saved := currentWorkDir
+	currentWorkDir = ws
+	defer func() { currentWorkDir = saved }()
+
+	path := filepath.Join(ws, "dir", "a.go")
+	writeTestFile(t, path, "package a\n")
+
+	w := fsRequest(t, handleDelete, map[string]string{"path": filepath.Join(ws, "dir")})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp map[string]string
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if data, err := os.ReadFile(filepath.Join(resp["trashPath"], "a.go")); err != nil || string(data) != "package a\n" {
+		t.Errorf("trashed file: %q, %v", data, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file still in place: %v", err)
+	}
+}
+
+// TestMoveTreeAcrossDevices needs a second filesystem; /dev/shm is one on
+// most Linux systems.
+func TestMoveTreeAcrossDevices(t *testing.T) {
+	other, err := os.MkdirTemp("/dev/shm", "gofast-test-")
+	if err != nil {
+		t.Skip("no second filesystem:", err)
+	}
+	defer os.RemoveAll(other)
+
+	from := filepath.Join(other, "dir")
+	writeTestFile(t, filepath.Join(from, "a.txt"), "a")
+	to := filepath.Join(t.TempDir(), "dir")
+	if err := os.Rename(from, to); err == nil || !isCrossDevice(err) {
+		t.Skipf("rename from /dev/shm is not cross-device: %v", err)
+	}
+
+	if err := moveTree(from, to); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(to, "a.txt")); err != nil || string(data) != "a" {
+		t.Errorf("moved file: %q, %v", data, err)
+	}
+	if _, err := os.Stat(from); !os.IsNotExist(err) {
+		t.Errorf("source still there: %v", err)
+	}
+}
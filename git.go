@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gitError is a failed git command, keeping what the client needs to show
+// the failure: git's own message and exit code.
+type gitError struct {
+	Args     []string
+	Stderr   string
+	ExitCode int
+	Err      error
+}
+
+func (e *gitError) Error() string {
+	msg := strings.TrimSpace(e.Stderr)
+	if msg == "" {
+		msg = e.Err.Error()
+	}
+	return "git " + strings.Join(e.Args, " ") + ": " + msg
+}
+
+func (e *gitError) Unwrap() error { return e.Err }
+
+// runGit runs git in dir and returns its standard output.
+func runGit(dir string, args ...string) ([]byte, error) {
+	return runGitInput(dir, nil, args...)
+}
+
+// runGitInput is runGit with data fed to git's standard input.
+func runGitInput(dir string, input []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	hideWindow(cmd)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	if err := cmd.Run(); err != nil {
+		msg := stderr.String()
+		if strings.TrimSpace(msg) == "" {
+			msg = stdout.String() // Some refusals, like "nothing to commit", go to stdout
+		}
+		gerr := &gitError{Args: args, Stderr: msg, ExitCode: -1, Err: err}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			gerr.ExitCode = exitErr.ExitCode()
+		}
+		return stdout.Bytes(), gerr
+	}
+	return stdout.Bytes(), nil
+}
+
+// gitTopLevel returns the root of the repository containing dir.
+func gitTopLevel(dir string) (string, error) {
+	out, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return filepath.FromSlash(strings.TrimSpace(string(out))), nil
+}
+
+// gitFileStatus is one entry of git status --porcelain: X is the index
+// status, Y the work tree status. OrigPath is set for renames and copies.
+type gitFileStatus struct {
+	X, Y     byte
+	Path     string // Absolute
+	OrigPath string
+}
+
+// gitStatus returns the repository root and the status of changed,
+// untracked and conflicted files under dir.
+func gitStatus(dir string) (string, []gitFileStatus, error) {
+	top, err := gitTopLevel(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	out, err := runGit(top, "status", "--porcelain=v1", "-z", "--untracked-files=all")
+	if err != nil {
+		return "", nil, err
+	}
+
+	var files []gitFileStatus
+	fields := strings.Split(string(out), "\x00")
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if len(f) < 4 {
+			continue
+		}
+		st := gitFileStatus{X: f[0], Y: f[1], Path: filepath.Join(top, filepath.FromSlash(f[3:]))}
+		if (st.X == 'R' || st.X == 'C') && i+1 < len(fields) {
+			i++
+			st.OrigPath = filepath.Join(top, filepath.FromSlash(fields[i]))
+		}
+		files = append(files, st)
+	}
+	return top, files, nil
+}
+
+// Marker returns the single-letter status shown in the file tree: "U" for
+// conflicts, "?" for untracked, otherwise the work tree status, falling
+// back to the index status (M, A, D, R, C).
+func (s gitFileStatus) Marker() string {
+	switch {
+	case s.X == 'U' || s.Y == 'U' || (s.X == 'A' && s.Y == 'A') || (s.X == 'D' && s.Y == 'D'):
+		return "U"
+	case s.X == '?':
+		return "?"
+	case s.X == '!':
+		return "!"
+	case s.Y != ' ':
+		return string(s.Y)
+	}
+	return string(s.X)
+}
+
+// gitStatusMarkers maps changed paths under dir to their tree markers.
+// Directories get the most important marker of their contents: "U" for a
+// conflict, else "M" for changes, else "?" if they only hold untracked
+// files. It is empty outside a repository.
+func gitStatusMarkers(dir string) map[string]string {
+	rank := map[string]int{"?": 1, "M": 2, "U": 3}
+	markers := make(map[string]string)
+	top, files, err := gitStatus(dir)
+	if err != nil {
+		return markers
+	}
+	for _, f := range files {
+		marker := f.Marker()
+		markers[f.Path] = marker
+		if marker != "U" && marker != "?" {
+			marker = "M"
+		}
+		for parent := filepath.Dir(f.Path); pathWithin(top, parent) && parent != top; parent = filepath.Dir(parent) {
+			if rank[marker] > rank[markers[parent]] {
+				markers[parent] = marker
+			}
+		}
+	}
+	return markers
+}
+
+const gitStatusTTL = 30 * time.Second // Catch changes nothing else reports
+
+// The file tree's git markers, cached per repository between refreshes.
+// Watcher events clear the cache. An entry also goes stale when the index
+// changes (staging, commits, branch switches, inside the editor or not),
+// since the watcher doesn't look into .git, and once it is gitStatusTTL old.
+var (
+	gitTops        = map[string]string{} // Directory -> repository root, "" outside one
+	gitMarkerCache = map[string]gitMarkerEntry{}
+	gitMarkerMutex sync.Mutex
+)
+
+type gitMarkerEntry struct {
+	markers map[string]string
+	index   time.Time // Modification time of .git/index
+	built   time.Time
+}
+
+func invalidateGitStatus() {
+	gitMarkerMutex.Lock()
+	gitTops = map[string]string{}
+	gitMarkerCache = map[string]gitMarkerEntry{}
+	gitMarkerMutex.Unlock()
+}
+
+// cachedGitStatusMarkers is gitStatusMarkers, reusing the repository's last
+// result while it is fresh.
+func cachedGitStatusMarkers(dir string) map[string]string {
+	gitMarkerMutex.Lock()
+	defer gitMarkerMutex.Unlock()
+
+	top, ok := gitTops[dir]
+	if !ok {
+		top, _ = gitTopLevel(dir)
+		gitTops[dir] = top
+	}
+	if top == "" {
+		return map[string]string{}
+	}
+	indexTime := func() time.Time {
+		if info, err := os.Stat(filepath.Join(top, ".git", "index")); err == nil {
+			return info.ModTime()
+		}
+		return time.Time{}
+	}
+	if e, ok := gitMarkerCache[top]; ok && e.index.Equal(indexTime()) && time.Since(e.built) < gitStatusTTL {
+		return e.markers
+	}
+
+	markers := gitStatusMarkers(top)
+	// Read after git status, which may have refreshed the index itself
+	gitMarkerCache[top] = gitMarkerEntry{markers: markers, index: indexTime(), built: time.Now()}
+	return markers
+}
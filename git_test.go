@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestCachedGitStatusMarkers(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	if _, err := runGit(dir, "init", "-q"); err != nil {
+		t.Fatal(err)
+	}
+	top, err := gitTopLevel(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := filepath.Join(top, "a.txt"), filepath.Join(top, "b.txt")
+	if err := os.WriteFile(a, []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalidateGitStatus()
+
+	if got := cachedGitStatusMarkers(dir)[a]; got != "?" {
+		t.Fatalf("marker of a new file = %q, want ?", got)
+	}
+
+	// Work tree changes show up once the watcher invalidates the cache
+	if err := os.WriteFile(b, []byte("b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := cachedGitStatusMarkers(dir)[b]; got != "" {
+		t.Errorf("marker of b before invalidation = %q, want the cached result", got)
+	}
+	invalidateGitStatus()
+	if got := cachedGitStatusMarkers(dir)[b]; got != "?" {
+		t.Errorf("marker of b after invalidation = %q, want ?", got)
+	}
+
+	// Staging changes the index, which makes the entry stale by itself
+	if _, err := runGit(dir, "add", "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got := cachedGitStatusMarkers(dir)[a]; got == "?" {
+		t.Errorf("marker of a staged file is still %q", got)
+	}
+}
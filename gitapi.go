@@ -0,0 +1,428 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// GitStatusEntry is one changed file in /api/git/status.
+type GitStatusEntry struct {
+	Path     string `json:"path"`
+	OrigPath string `json:"origPath,omitempty"`
+	Index    string `json:"index"`    // Staged status, " " if none
+	Worktree string `json:"worktree"` // Unstaged status, " " if none
+	Marker   string `json:"marker"`
+}
+
+// writeGitError answers a failed git operation. Git's own refusals (exit
+// status, message) come back as JSON with status 422 so the client can show
+// them; anything else is a 500.
+func writeGitError(w http.ResponseWriter, err error) {
+	var gerr *gitError
+	if !errors.As(err, &gerr) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":    gerr.Error(),
+		"type":     "git",
+		"command":  "git " + strings.Join(gerr.Args, " "),
+		"stderr":   strings.TrimSpace(gerr.Stderr),
+		"exitCode": gerr.ExitCode,
+	})
+}
+
+// gitRepoDir returns the directory git commands run in, failing if there
+// is no workspace.
+func gitRepoDir(w http.ResponseWriter) (string, bool) {
+	if currentWorkDir == "" {
+		http.Error(w, "No workspace directory set", http.StatusBadRequest)
+		return "", false
+	}
+	return currentWorkDir, true
+}
+
+// hasHead reports whether the repository has a commit yet.
+func hasHead(dir string) bool {
+	_, err := runGit(dir, "rev-parse", "-q", "--verify", "HEAD")
+	return err == nil
+}
+
+func handleGitStatus(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := gitRepoDir(w)
+	if !ok {
+		return
+	}
+	top, files, err := gitStatus(dir)
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	branch, _ := runGit(dir, "symbolic-ref", "--short", "-q", "HEAD") // Empty when detached
+
+	entries := []GitStatusEntry{}
+	for _, f := range files {
+		entries = append(entries, GitStatusEntry{
+			Path:     f.Path,
+			OrigPath: f.OrigPath,
+			Index:    string(f.X),
+			Worktree: string(f.Y),
+			Marker:   f.Marker(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"root":    top,
+		"branch":  strings.TrimSpace(string(branch)),
+		"hasHead": hasHead(dir),
+		"files":   entries,
+	})
+}
+
+// gitDiff is a parsed single-file git diff: the header lines up to the
+// first hunk, which a patch for any one hunk needs, and the hunks.
+type gitDiff struct {
+	Header []string
+	Hunks  []DiffHunk
+}
+
+// parseGitDiff parses the unified diff of one file. Hunk lines keep their
+// prefix, including "\ No newline at end of file" markers, and their raw
+// bytes: a CRLF file's lines keep the \r, or the patch would not apply.
+func parseGitDiff(text string) (*gitDiff, error) {
+	d := &gitDiff{}
+	var cur *DiffHunk
+	lines := strings.Split(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "@@ ") {
+			h, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			d.Hunks = append(d.Hunks, h)
+			cur = &d.Hunks[len(d.Hunks)-1]
+			continue
+		}
+		if cur == nil {
+			d.Header = append(d.Header, line)
+		} else {
+			cur.Lines = append(cur.Lines, line)
+		}
+	}
+	return d, nil
+}
+
+// parseHunkHeader parses "@@ -a,b +c,d @@ ..."; omitted counts are 1.
+func parseHunkHeader(line string) (DiffHunk, error) {
+	var h DiffHunk
+	fields := strings.Fields(line)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return h, fmt.Errorf("bad hunk header %q", line)
+	}
+	parse := func(s string) (int, int, error) {
+		start, count, ok := strings.Cut(s[1:], ",")
+		a, err := strconv.Atoi(start)
+		if err != nil {
+			return 0, 0, fmt.Errorf("bad hunk header %q", line)
+		}
+		if !ok {
+			return a, 1, nil
+		}
+		b, err := strconv.Atoi(count)
+		if err != nil {
+			return 0, 0, fmt.Errorf("bad hunk header %q", line)
+		}
+		return a, b, nil
+	}
+	var err error
+	if h.OldStart, h.OldLines, err = parse(fields[1]); err != nil {
+		return h, err
+	}
+	h.NewStart, h.NewLines, err = parse(fields[2])
+	return h, err
+}
+
+func hunkHeader(h DiffHunk) string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// patch renders the file header and the given hunk as a patch for git apply.
+func (d *gitDiff) patch(i int) []byte {
+	var sb strings.Builder
+	for _, line := range d.Header {
+		sb.WriteString(line + "\n")
+	}
+	h := d.Hunks[i]
+	sb.WriteString(hunkHeader(h) + "\n")
+	for _, line := range h.Lines {
+		sb.WriteString(line + "\n")
+	}
+	return []byte(sb.String())
+}
+
+// diffFile returns the diff of one file: work tree against the index, the
+// index against HEAD (staged), or the work tree against HEAD.
+func diffFile(dir, path, against string) (string, error) {
+	args := []string{"diff", "--no-color", "--no-ext-diff", "-U3"}
+	switch against {
+	case "staged":
+		args = append(args, "--cached")
+	case "HEAD":
+		args = append(args, "HEAD")
+	}
+	out, err := runGit(dir, append(args, "--", path)...)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// handleGitDiff returns the diff of a file as text and parsed hunks.
+// against is "index" (default: unstaged changes), "staged" or "HEAD".
+// Untracked files are shown as all added.
+func handleGitDiff(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := gitRepoDir(w)
+	if !ok {
+		return
+	}
+	path, ok := checkWorkspacePath(w, r, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+	against := r.URL.Query().Get("against")
+
+	text, err := diffFile(dir, path, against)
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	if text == "" && against != "staged" {
+		text = untrackedDiff(dir, path)
+	}
+	d, err := parseGitDiff(text)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if d.Hunks == nil {
+		d.Hunks = []DiffHunk{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":  path,
+		"diff":  text,
+		"hunks": d.Hunks,
+	})
+}
+
+// untrackedDiff renders an untracked file as a diff against nothing. It is
+// empty if the file is tracked or unreadable.
+func untrackedDiff(dir, path string) string {
+	if _, err := runGit(dir, "ls-files", "--error-unmatch", "--", path); err == nil {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || isBinary(data[:min(len(data), sniffSize)]) {
+		return ""
+	}
+	text, _ := decodeFile(data)
+	lines := splitLines(text)
+	if len(lines) == 0 {
+		return ""
+	}
+	name := filepath.ToSlash(mustRel(dir, path))
+	return unifiedDiff("/dev/null", "b/"+name, diffHunks(diffLines(nil, lines), 0))
+}
+
+// decodeGitPaths decodes a JSON body with a list of paths, resolving each
+// against the workspace.
+func decodeGitPaths(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var req struct {
+		Paths []string `json:"paths"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if len(req.Paths) == 0 {
+		http.Error(w, "paths required", http.StatusBadRequest)
+		return nil, false
+	}
+	for i, p := range req.Paths {
+		resolved, ok := checkWorkspacePath(w, r, p)
+		if !ok {
+			return nil, false
+		}
+		req.Paths[i] = resolved
+	}
+	return req.Paths, true
+}
+
+// handleGitStage stages whole files, including deletions.
+func handleGitStage(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := gitRepoDir(w)
+	if !ok {
+		return
+	}
+	paths, ok := decodeGitPaths(w, r)
+	if !ok {
+		return
+	}
+	if _, err := runGit(dir, append([]string{"add", "-A", "--"}, paths...)...); err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeFsOK(w, map[string]string{})
+}
+
+// handleGitUnstage moves staged changes of whole files back to the work tree.
+func handleGitUnstage(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := gitRepoDir(w)
+	if !ok {
+		return
+	}
+	paths, ok := decodeGitPaths(w, r)
+	if !ok {
+		return
+	}
+	args := []string{"reset", "-q", "--"}
+	if !hasHead(dir) {
+		args = []string{"rm", "-r", "-q", "--cached", "--"} // Nothing to reset to yet
+	}
+	if _, err := runGit(dir, append(args, paths...)...); err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeFsOK(w, map[string]string{})
+}
+
+// handleGitStageHunk stages one hunk of a file's unstaged diff, or with
+// unstage set unstages one hunk of its staged diff. Hunk is the index into
+// the hunks /api/git/diff returned; Header, if given, must still match it,
+// so a hunk that moved since is not applied by mistake.
+func handleGitStageHunk(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := gitRepoDir(w)
+	if !ok {
+		return
+	}
+	var req struct {
+		Path    string `json:"path"`
+		Hunk    int    `json:"hunk"`
+		Header  string `json:"header"`
+		Unstage bool   `json:"unstage"`
+	}
+	if !decodeFsRequest(w, r, &req, &req.Path) {
+		return
+	}
+
+	against := "index"
+	if req.Unstage {
+		against = "staged"
+	}
+	text, err := diffFile(dir, req.Path, against)
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	d, err := parseGitDiff(text)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if req.Hunk < 0 || req.Hunk >= len(d.Hunks) {
+		http.Error(w, "No such hunk; refresh the diff", http.StatusConflict)
+		return
+	}
+	if req.Header != "" && !strings.HasPrefix(req.Header, hunkHeader(d.Hunks[req.Hunk])) {
+		http.Error(w, "The diff changed; refresh it", http.StatusConflict)
+		return
+	}
+
+	args := []string{"apply", "--cached", "--whitespace=nowarn"}
+	if req.Unstage {
+		args = append(args, "--reverse")
+	}
+	if _, err := runGitInput(dir, d.patch(req.Hunk), append(args, "-")...); err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeFsOK(w, map[string]string{"path": req.Path})
+}
+
+// handleGitCommit commits what is staged.
+func handleGitCommit(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := gitRepoDir(w)
+	if !ok {
+		return
+	}
+	var req struct {
+		Message string `json:"message"`
+		Amend   bool   `json:"amend"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		http.Error(w, "Commit message required", http.StatusBadRequest)
+		return
+	}
+
+	args := []string{"commit", "-q", "-F", "-"}
+	if req.Amend {
+		args = append(args, "--amend")
+	}
+	if _, err := runGitInput(dir, []byte(req.Message), args...); err != nil {
+		writeGitError(w, err)
+		return
+	}
+	hash, err := runGit(dir, "rev-parse", "HEAD")
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeFsOK(w, map[string]string{"commit": strings.TrimSpace(string(hash))})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHunkHeader(t *testing.T) {
+	tests := []struct {
+		line string
+		want DiffHunk
+		err  bool
+	}{
+		{"@@ -1,3 +1,4 @@", DiffHunk{OldStart: 1, OldLines: 3, NewStart: 1, NewLines: 4}, false},
+		{"@@ -5 +5 @@ func main() {", DiffHunk{OldStart: 5, OldLines: 1, NewStart: 5, NewLines: 1}, false},
+		{"@@ -0,0 +1,2 @@", DiffHunk{OldStart: 0, OldLines: 0, NewStart: 1, NewLines: 2}, false},
+		{"@@ -x,1 +1 @@", DiffHunk{}, true},
+		{"@@ 1,1 1,1 @@", DiffHunk{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseHunkHeader(tt.line)
+		if (err != nil) != tt.err {
+			t.Errorf("parseHunkHeader(%q) error = %v, want error %v", tt.line, err, tt.err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseHunkHeader(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseGitDiff(t *testing.T) {
+	text := "diff --git a/f.txt b/f.txt\n" +
+		"index 1111111..2222222 100644\n" +
+		"--- a/f.txt\n" +
+		"+++ b/f.txt\n" +
+		"@@ -1,2 +1,2 @@\n" +
+		" one\r\n" +
+		"-two\r\n" +
+		"+2\r\n" +
+		"@@ -9 +9 @@ ctx\n" +
+		"-last\n" +
+		"\\ No newline at end of file\n" +
+		"+LAST\n"
+	d, err := parseGitDiff(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Header) != 4 || len(d.Hunks) != 2 {
+		t.Fatalf("got %d header lines and %d hunks, want 4 and 2", len(d.Header), len(d.Hunks))
+	}
+	if want := []string{" one\r", "-two\r", "+2\r"}; !reflect.DeepEqual(d.Hunks[0].Lines, want) {
+		t.Errorf("hunk 0 lines = %q, want %q", d.Hunks[0].Lines, want)
+	}
+	if want := []string{"-last", "\\ No newline at end of file", "+LAST"}; !reflect.DeepEqual(d.Hunks[1].Lines, want) {
+		t.Errorf("hunk 1 lines = %q, want %q", d.Hunks[1].Lines, want)
+	}
+
+	want := "diff --git a/f.txt b/f.txt\n" +
+		"index 1111111..2222222 100644\n" +
+		"--- a/f.txt\n" +
+		"+++ b/f.txt\n" +
+		"@@ -1,2 +1,2 @@\n" +
+		" one\r\n" +
+		"-two\r\n" +
+		"+2\r\n"
+	if got := string(d.patch(0)); got != want {
+		t.Errorf("patch(0) = %q, want %q", got, want)
+	}
+
+	if d, err := parseGitDiff(""); err != nil || len(d.Header)+len(d.Hunks) != 0 {
+		t.Errorf("parseGitDiff(\"\") = %+v, %v, want empty", d, err)
+	}
+}
+
+// TestStageHunkCRLF stages one hunk of a CRLF file through git apply.
+func TestStageHunkCRLF(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		out, err := runGit(dir, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+	git("init", "-q")
+	git("config", "core.autocrlf", "false")
+	git("config", "user.email", "test@example.com")
+	git("config", "user.name", "test")
+
+	lines := []string{"l1", "l2", "l3", "l4", "l5", "l6", "l7", "l8", "l9", "l10", "l11", "l12"}
+	path := filepath.Join(dir, "f.txt")
+	write := func(lines []string) {
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(lines)
+	git("add", ".")
+	git("commit", "-q", "-m", "init")
+
+	lines[1], lines[10] = "L2", "L11"
+	write(lines)
+	text, err := diffFile(dir, path, "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := parseGitDiff(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Hunks) != 2 {
+		t.Fatalf("got %d hunks, want 2", len(d.Hunks))
+	}
+	if _, err := runGitInput(dir, d.patch(1), "apply", "--cached", "-"); err != nil {
+		t.Fatal(err)
+	}
+	staged := git("diff", "--cached")
+	if !strings.Contains(staged, "+L11\r\n") || strings.Contains(staged, "L2") {
+		t.Errorf("staged diff = %q, want only the second hunk", staged)
+	}
+}
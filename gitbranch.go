@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Branch is a local branch in /api/git/branches.
+type Branch struct {
+	Name     string    `json:"name"`
+	Commit   string    `json:"commit"`
+	Upstream string    `json:"upstream,omitempty"`
+	Ahead    int       `json:"ahead"`
+	Behind   int       `json:"behind"`
+	Current  bool      `json:"current"`
+	Date     time.Time `json:"date"`
+	Subject  string    `json:"subject"`
+}
+
+// StashEntry is one entry of git stash list; Index is n in stash@{n}.
+type StashEntry struct {
+	Index   int       `json:"index"`
+	Commit  string    `json:"commit"`
+	Message string    `json:"message"`
+	Date    time.Time `json:"date"`
+}
+
+// refuseDirtyBuffers answers 409 if the client reports open buffers with
+// unsaved changes, which an operation rewriting files on disk would leave
+// out of step with the work tree.
+func refuseDirtyBuffers(w http.ResponseWriter, dirty []string) bool {
+	if len(dirty) == 0 {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": "Save or discard unsaved changes first",
+		"type":  "dirty_buffers",
+		"paths": dirty,
+	})
+	return true
+}
+
+// checkBranchName rejects names git would not accept as a branch, or would
+// take for an option.
+func checkBranchName(w http.ResponseWriter, dir, name string) bool {
+	if name == "" || strings.HasPrefix(name, "-") {
+		http.Error(w, "Invalid branch name", http.StatusBadRequest)
+		return false
+	}
+	if _, err := runGit(dir, "check-ref-format", "--branch", name); err != nil {
+		http.Error(w, "Invalid branch name: "+name, http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// worktreeChanged re-indexes after git rewrote files in the work tree.
+func worktreeChanged() {
+	go updateIndex(currentWorkDir) // Re-index
+}
+
+func listBranches(dir string) ([]Branch, error) {
+	out, err := runGit(dir, "for-each-ref",
+		"--format=%(refname:short)%1f%(objectname:short)%1f%(upstream:short)%1f%(upstream:track,nobracket)%1f%(HEAD)%1f%(committerdate:iso-strict)%1f%(contents:subject)",
+		"refs/heads")
+	if err != nil {
+		return nil, err
+	}
+
+	branches := []Branch{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		f := strings.Split(line, "\x1f")
+		if len(f) != 7 {
+			continue
+		}
+		b := Branch{Name: f[0], Commit: f[1], Upstream: f[2], Current: f[4] == "*", Subject: f[6]}
+		b.Date, _ = time.Parse(time.RFC3339, f[5])
+		// Track is like "ahead 1, behind 2", or "gone"
+		for _, part := range strings.Split(f[3], ", ") {
+			kind, n, _ := strings.Cut(part, " ")
+			switch kind {
+			case "ahead":
+				b.Ahead, _ = strconv.Atoi(n)
+			case "behind":
+				b.Behind, _ = strconv.Atoi(n)
+			}
+		}
+		branches = append(branches, b)
+	}
+	return branches, nil
+}
+
+func handleGitBranches(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := gitRepoDir(w)
+	if !ok {
+		return
+	}
+	branches, err := listBranches(dir)
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	// Empty when detached or before the first commit has a branch
+	current, _ := runGit(dir, "symbolic-ref", "--short", "-q", "HEAD")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"current":  strings.TrimSpace(string(current)),
+		"branches": branches,
+	})
+}
+
+// handleGitCreateBranch creates a branch at startPoint (default HEAD),
+// switching to it if checkout is set.
+func handleGitCreateBranch(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := gitRepoDir(w)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name         string   `json:"name"`
+		StartPoint   string   `json:"startPoint"`
+		Checkout     bool     `json:"checkout"`
+		DirtyBuffers []string `json:"dirtyBuffers"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkBranchName(w, dir, req.Name) {
+		return
+	}
+	if strings.HasPrefix(req.StartPoint, "-") {
+		http.Error(w, "Invalid start point", http.StatusBadRequest)
+		return
+	}
+
+	args := []string{"branch", req.Name}
+	if req.Checkout {
+		if refuseDirtyBuffers(w, req.DirtyBuffers) {
+			return
+		}
+		args = []string{"switch", "-q", "-c", req.Name}
+	}
+	if req.StartPoint != "" {
+		args = append(args, req.StartPoint)
+	}
+	if _, err := runGit(dir, args...); err != nil {
+		writeGitError(w, err)
+		return
+	}
+	if req.Checkout {
+		log.Printf("Switched to new branch %s\n", req.Name)
+		worktreeChanged()
+	}
+	writeFsOK(w, map[string]string{"name": req.Name})
+}
+
+// handleGitSwitchBranch checks out a branch. Git itself refuses if local
+// changes on disk would be overwritten.
+func handleGitSwitchBranch(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := gitRepoDir(w)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name         string   `json:"name"`
+		DirtyBuffers []string `json:"dirtyBuffers"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkBranchName(w, dir, req.Name) || refuseDirtyBuffers(w, req.DirtyBuffers) {
+		return
+	}
+
+	if _, err := runGit(dir, "switch", "-q", req.Name); err != nil {
+		writeGitError(w, err)
+		return
+	}
+	log.Printf("Switched to branch %s\n", req.Name)
+	worktreeChanged()
+	writeFsOK(w, map[string]string{"name": req.Name})
+}
+
+// handleGitDeleteBranch deletes a branch; unmerged branches need force.
+func handleGitDeleteBranch(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := gitRepoDir(w)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name  string `json:"name"`
+		Force bool   `json:"force"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkBranchName(w, dir, req.Name) {
+		return
+	}
+
+	flag := "-d"
+	if req.Force {
+		flag = "-D"
+	}
+	if _, err := runGit(dir, "branch", flag, req.Name); err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeFsOK(w, map[string]string{"name": req.Name})
+}
+
+func listStashes(dir string) ([]StashEntry, error) {
+	out, err := runGit(dir, "stash", "list", "--format=%gd%x1f%H%x1f%gs%x1f%cI")
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []StashEntry{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		f := strings.Split(line, "\x1f")
+		if len(f) != 4 {
+			continue
+		}
+		e := StashEntry{Commit: f[1], Message: f[2]}
+		// %gd is stash@{n}
+		e.Index, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(f[0], "stash@{"), "}"))
+		e.Date, _ = time.Parse(time.RFC3339, f[3])
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// handleGitStash lists stashes (GET) or stashes the work tree's changes
+// (POST).
+func handleGitStash(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := gitRepoDir(w)
+	if !ok {
+		return
+	}
+
+	if r.Method == "GET" {
+		entries, err := listStashes(dir)
+		if err != nil {
+			writeGitError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+		return
+	}
+
+	var req struct {
+		Message          string   `json:"message"`
+		IncludeUntracked bool     `json:"includeUntracked"`
+		DirtyBuffers     []string `json:"dirtyBuffers"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if refuseDirtyBuffers(w, req.DirtyBuffers) {
+		return
+	}
+
+	args := []string{"stash", "push", "-q"}
+	if req.IncludeUntracked {
+		args = append(args, "--include-untracked")
+	}
+	if req.Message != "" {
+		args = append(args, "-m", req.Message)
+	}
+	if _, err := runGit(dir, args...); err != nil {
+		writeGitError(w, err)
+		return
+	}
+	worktreeChanged()
+	writeFsOK(w, map[string]string{})
+}
+
+// handleGitUnstash restores stash@{index} into the work tree, dropping it
+// unless keep is set, or with drop set only discards it.
+func handleGitUnstash(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := gitRepoDir(w)
+	if !ok {
+		return
+	}
+	var req struct {
+		Index        int      `json:"index"`
+		Keep         bool     `json:"keep"`
+		Drop         bool     `json:"drop"`
+		DirtyBuffers []string `json:"dirtyBuffers"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Index < 0 {
+		http.Error(w, "Invalid stash index", http.StatusBadRequest)
+		return
+	}
+	ref := "stash@{" + strconv.Itoa(req.Index) + "}"
+
+	var args []string
+	switch {
+	case req.Drop:
+		args = []string{"stash", "drop", "-q", ref}
+	case req.Keep:
+		args = []string{"stash", "apply", "-q", ref}
+	default:
+		args = []string{"stash", "pop", "-q", ref}
+	}
+	if !req.Drop && refuseDirtyBuffers(w, req.DirtyBuffers) {
+		return
+	}
+	if _, err := runGit(dir, args...); err != nil {
+		writeGitError(w, err)
+		return
+	}
+	if !req.Drop {
+		worktreeChanged()
+	}
+	writeFsOK(w, map[string]string{})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRefuseDirtyBuffers(t *testing.T) {
+	w := httptest.NewRecorder()
+	if refuseDirtyBuffers(w, nil) {
+		t.Error("refused without dirty buffers")
+	}
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("wrote a response without dirty buffers: %d %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	if !refuseDirtyBuffers(w, []string{"/ws/a.go", "/ws/b.go"}) {
+		t.Fatal("not refused with dirty buffers")
+	}
+	if w.Code != http.StatusConflict {
+		t.Errorf("status %d, want 409", w.Code)
+	}
+	var body struct {
+		Type  string   `json:"type"`
+		Paths []string `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Type != "dirty_buffers" || !reflect.DeepEqual(body.Paths, []string{"/ws/a.go", "/ws/b.go"}) {
+		t.Errorf("body = %+v", body)
+	}
+}
+
+// TestDirtyBuffersBlockWorktreeChanges checks that every endpoint rewriting
+// the work tree answers 409 and leaves the repository alone when the client
+// reports unsaved buffers.
+func TestDirtyBuffersBlockWorktreeChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		out, err := runGit(dir, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q", "-b", "main")
+	git("config", "user.email", "test@example.com")
+	git("config", "user.name", "test")
+	path := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(path, []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", ".")
+	git("commit", "-q", "-m", "init")
+	git("branch", "other")
+	if err := os.WriteFile(path, []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("stash", "push", "-q")
+	if err := os.WriteFile(path, []byte("changed again\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := currentWorkDir
+	currentWorkDir = dir
+	defer func() { currentWorkDir = saved }()
+
+	dirty := []string{path}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    map[string]interface{}
+	}{
+		{"switch", handleGitSwitchBranch, map[string]interface{}{"name": "other", "dirtyBuffers": dirty}},
+		{"create and switch", handleGitCreateBranch, map[string]interface{}{"name": "new", "checkout": true, "dirtyBuffers": dirty}},
+		{"stash", handleGitStash, map[string]interface{}{"dirtyBuffers": dirty}},
+		{"pop", handleGitUnstash, map[string]interface{}{"index": 0, "dirtyBuffers": dirty}},
+		{"apply", handleGitUnstash, map[string]interface{}{"index": 0, "keep": true, "dirtyBuffers": dirty}},
+	}
+	for _, tt := range tests {
+		data, _ := json.Marshal(tt.body)
+		w := httptest.NewRecorder()
+		tt.handler(w, httptest.NewRequest("POST", "/api/git", bytes.NewReader(data)))
+		if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "dirty_buffers") {
+			t.Errorf("%s: status %d: %s", tt.name, w.Code, w.Body)
+		}
+	}
+
+	if branch := git("branch", "--show-current"); branch != "main" {
+		t.Errorf("switched to %s", branch)
+	}
+	if _, err := runGit(dir, "rev-parse", "-q", "--verify", "refs/heads/new"); err == nil {
+		t.Error("branch created")
+	}
+	if n := len(strings.Split(git("stash", "list"), "\n")); n != 1 {
+		t.Errorf("%d stashes, want 1", n)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "changed again\n" {
+		t.Errorf("work tree changed: %q", data)
+	}
+
+	// Dropping a stash leaves the work tree alone, so dirty buffers don't matter
+	data, _ := json.Marshal(map[string]interface{}{"index": 0, "drop": true, "dirtyBuffers": dirty})
+	w := httptest.NewRecorder()
+	handleGitUnstash(w, httptest.NewRequest("POST", "/api/git/unstash", bytes.NewReader(data)))
+	if w.Code != http.StatusOK {
+		t.Errorf("drop: status %d: %s", w.Code, w.Body)
+	}
+	if list := git("stash", "list"); list != "" {
+		t.Errorf("stash not dropped: %s", list)
+	}
+}
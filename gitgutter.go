@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Gutter change types
+const (
+	gutterAdded    = "added"
+	gutterModified = "modified"
+	gutterDeleted  = "deleted"
+)
+
+// GutterChange is a changed region of the buffer compared to HEAD. Start
+// and End are 1-based buffer lines, inclusive. For a deletion both are the
+// line the removed lines followed (0 at the top of the file). Original
+// holds the HEAD lines the region replaced, so reverting is: replace lines
+// Start..End with Original, or for a deletion insert Original after Start.
+type GutterChange struct {
+	Type     string   `json:"type"`
+	Start    int      `json:"start"`
+	End      int      `json:"end"`
+	OldStart int      `json:"oldStart"`
+	Original []string `json:"original"`
+}
+
+// gutterChanges groups a line diff into changed regions: each run of
+// deletions and insertions between unchanged lines is one region.
+func gutterChanges(ops []diffOp) []GutterChange {
+	changes := []GutterChange{}
+	oldLine, newLine := 0, 0
+	var cur *GutterChange
+	inserted := 0
+	closeChange := func() {
+		if cur == nil {
+			return
+		}
+		switch {
+		case inserted == 0:
+			cur.Type = gutterDeleted
+			cur.Start, cur.End = cur.Start-1, cur.Start-1
+		case len(cur.Original) == 0:
+			cur.Type = gutterAdded
+		default:
+			cur.Type = gutterModified
+		}
+		changes = append(changes, *cur)
+		cur, inserted = nil, 0
+	}
+
+	for _, op := range ops {
+		if op.Kind == diffEqual {
+			closeChange()
+			oldLine++
+			newLine++
+			continue
+		}
+		if cur == nil {
+			cur = &GutterChange{Start: newLine + 1, OldStart: oldLine + 1, Original: []string{}}
+		}
+		if op.Kind == diffDelete {
+			oldLine++
+			cur.Original = append(cur.Original, op.Line)
+		} else {
+			newLine++
+			inserted++
+			cur.End = newLine
+		}
+	}
+	closeChange()
+	return changes
+}
+
+// headVersion returns the text of path in HEAD. ok is false if the file
+// is not in HEAD (new, untracked or no commits yet) or is binary.
+func headVersion(dir, path string) (text string, ok bool, err error) {
+	top, err := gitTopLevel(dir)
+	if err != nil {
+		return "", false, err
+	}
+	rel := filepath.ToSlash(mustRel(top, realPath(path)))
+	if _, err := runGit(top, "cat-file", "-e", "HEAD:"+rel); err != nil {
+		return "", false, nil
+	}
+	data, err := runGit(top, "show", "HEAD:"+rel)
+	if err != nil {
+		return "", false, err
+	}
+	if isBinary(data[:min(len(data), sniffSize)]) {
+		return "", false, nil
+	}
+	text, _ = decodeFile(data)
+	return text, true, nil
+}
+
+// handleGitGutter compares a buffer, unsaved content included, with the
+// file's HEAD version for the editor's change bars. Without content the
+// file on disk is compared.
+func handleGitGutter(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := gitRepoDir(w)
+	if !ok {
+		return
+	}
+	var req struct {
+		Path    string  `json:"path"`
+		Content *string `json:"content"`
+	}
+	if !decodeFsRequest(w, r, &req, &req.Path) {
+		return
+	}
+
+	var content string
+	if req.Content != nil {
+		content = *req.Content
+	} else {
+		data, err := os.ReadFile(req.Path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		content, _ = decodeFile(data)
+	}
+
+	head, tracked, err := headVersion(dir, req.Path)
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":    req.Path,
+		"tracked": tracked,
+		"changes": gutterChanges(diffLines(splitLines(head), splitLines(content))),
+	})
+}
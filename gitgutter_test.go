@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// parseOps builds an edit script from lines prefixed with ' ', '-' or '+'.
+func parseOps(lines ...string) []diffOp {
+	ops := make([]diffOp, len(lines))
+	for i, l := range lines {
+		ops[i] = diffOp{Kind: l[0], Line: l[1:]}
+	}
+	return ops
+}
+
+func TestGutterChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []diffOp
+		want []GutterChange
+	}{
+		{"unchanged", parseOps(" a", " b"), []GutterChange{}},
+		{"empty", nil, []GutterChange{}},
+		{
+			"added at the top", parseOps("+a", " b"),
+			[]GutterChange{{Type: gutterAdded, Start: 1, End: 1, OldStart: 1, Original: []string{}}},
+		},
+		{
+			"new file", parseOps("+a", "+b"),
+			[]GutterChange{{Type: gutterAdded, Start: 1, End: 2, OldStart: 1, Original: []string{}}},
+		},
+		{
+			"modified", parseOps(" a", "-b", "+B", " c"),
+			[]GutterChange{{Type: gutterModified, Start: 2, End: 2, OldStart: 2, Original: []string{"b"}}},
+		},
+		{
+			"modified and grown", parseOps(" a", "-b", "+B", "+C", " d"),
+			[]GutterChange{{Type: gutterModified, Start: 2, End: 3, OldStart: 2, Original: []string{"b"}}},
+		},
+		{
+			"modified and shrunk", parseOps("-a", "-b", "+A", " c"),
+			[]GutterChange{{Type: gutterModified, Start: 1, End: 1, OldStart: 1, Original: []string{"a", "b"}}},
+		},
+		{
+			"deleted in the middle", parseOps(" a", "-b", "-c", " d"),
+			[]GutterChange{{Type: gutterDeleted, Start: 1, End: 1, OldStart: 2, Original: []string{"b", "c"}}},
+		},
+		{
+			"deleted at the top", parseOps("-a", " b"),
+			[]GutterChange{{Type: gutterDeleted, Start: 0, End: 0, OldStart: 1, Original: []string{"a"}}},
+		},
+		{
+			"deleted at the end", parseOps(" a", "-b"),
+			[]GutterChange{{Type: gutterDeleted, Start: 1, End: 1, OldStart: 2, Original: []string{"b"}}},
+		},
+		{
+			"several regions", parseOps("-a", "+A", " b", "+c", " d", "-e"),
+			[]GutterChange{
+				{Type: gutterModified, Start: 1, End: 1, OldStart: 1, Original: []string{"a"}},
+				{Type: gutterAdded, Start: 3, End: 3, OldStart: 3, Original: []string{}},
+				{Type: gutterDeleted, Start: 4, End: 4, OldStart: 4, Original: []string{"e"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := gutterChanges(tt.ops)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestGutterChangesRevert checks that applying each change's Original in
+// reverse order turns the buffer back into the HEAD text.
+func TestGutterChangesRevert(t *testing.T) {
+	head := splitLines("package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(1)\n}\n")
+	buf := splitLines("package main\n\nfunc main() {\n\tfmt.Println(2)\n\tfmt.Println(3)\n}\n// end\n")
+
+	changes := gutterChanges(diffLines(head, buf))
+	lines := append([]string(nil), buf...)
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := changes[i]
+		if c.Type == gutterDeleted {
+			lines = append(lines[:c.Start], append(append([]string(nil), c.Original...), lines[c.Start:]...)...)
+			continue
+		}
+		lines = append(lines[:c.Start-1], append(append([]string(nil), c.Original...), lines[c.End:]...)...)
+	}
+	if !reflect.DeepEqual(lines, head) {
+		t.Errorf("reverted to\n%q\nwant\n%q", lines, head)
+	}
+}
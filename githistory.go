@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLogLimit = 100
+	maxLogLimit     = 1000
+)
+
+// BlameCommit describes a commit referenced by blame ranges.
+type BlameCommit struct {
+	Hash      string    `json:"hash"`
+	Author    string    `json:"author"`
+	Email     string    `json:"email"`
+	Date      time.Time `json:"date"`
+	Summary   string    `json:"summary"`
+	Committed bool      `json:"committed"` // False for lines not committed yet
+}
+
+// BlameRange is a run of consecutive lines (1-based, inclusive) last
+// changed by the same commit.
+type BlameRange struct {
+	Start     int    `json:"start"`
+	End       int    `json:"end"`
+	Commit    string `json:"commit"`
+	OrigStart int    `json:"origStart"` // First line in the commit's version of the file
+}
+
+// parseBlame parses git blame --porcelain output. Commit details are only
+// given the first time a commit appears, so they are collected in a map.
+func parseBlame(out string) (map[string]*BlameCommit, []BlameRange) {
+	commits := make(map[string]*BlameCommit)
+	ranges := []BlameRange{}
+	var cur *BlameCommit
+	var final, orig int
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "\t") {
+			// The line content ends the entry
+			if cur == nil {
+				continue
+			}
+			n := len(ranges)
+			if n > 0 && ranges[n-1].Commit == cur.Hash && ranges[n-1].End == final-1 {
+				ranges[n-1].End = final
+			} else {
+				ranges = append(ranges, BlameRange{Start: final, End: final, Commit: cur.Hash, OrigStart: orig})
+			}
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		if (len(key) == 40 || len(key) == 64) && isHex(key) {
+			fields := strings.Fields(value)
+			if len(fields) < 2 {
+				continue
+			}
+			orig, _ = strconv.Atoi(fields[0])
+			final, _ = strconv.Atoi(fields[1])
+			if commits[key] == nil {
+				commits[key] = &BlameCommit{Hash: key, Committed: strings.Trim(key, "0") != ""}
+			}
+			cur = commits[key]
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		switch key {
+		case "author":
+			cur.Author = value
+		case "author-mail":
+			cur.Email = strings.Trim(value, "<>")
+		case "author-time":
+			if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+				cur.Date = time.Unix(sec, 0)
+			}
+		case "summary":
+			cur.Summary = value
+		}
+	}
+	return commits, ranges
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// handleGitBlame returns who last changed each line of a file, as ranges of
+// lines and the commits they refer to.
+func handleGitBlame(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := gitRepoDir(w)
+	if !ok {
+		return
+	}
+	path, ok := checkWorkspacePath(w, r, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+
+	out, err := runGit(dir, "blame", "--porcelain", "--", path)
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	commits, ranges := parseBlame(string(out))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":    path,
+		"commits": commits,
+		"ranges":  ranges,
+	})
+}
+
+// LogEntry is one commit in a file's history. Path is the file's path in
+// that commit, which differs from the current one across renames.
+type LogEntry struct {
+	Hash    string    `json:"hash"`
+	Short   string    `json:"short"`
+	Author  string    `json:"author"`
+	Email   string    `json:"email"`
+	Date    time.Time `json:"date"`
+	Subject string    `json:"subject"`
+	Path    string    `json:"path"`
+}
+
+// fileLog returns the history of path, following renames, newest first.
+func fileLog(dir, path string, skip, limit int) ([]LogEntry, error) {
+	top, err := gitTopLevel(dir)
+	if err != nil {
+		return nil, err
+	}
+	// Each record starts with \x1e and has \x1f between fields, followed by
+	// the --name-status lines for the file. --skip loses track of renames
+	// with --follow, so skipped entries are fetched and dropped here.
+	out, err := runGit(top, "log", "--follow", "--name-status", "--no-color",
+		"--format=%x1e%H%x1f%h%x1f%an%x1f%ae%x1f%aI%x1f%s",
+		"-n", strconv.Itoa(skip+limit), "--", path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []LogEntry{}
+	for _, record := range strings.Split(string(out), "\x1e") {
+		lines := strings.Split(strings.TrimSpace(record), "\n")
+		fields := strings.Split(lines[0], "\x1f")
+		if len(fields) != 6 {
+			continue
+		}
+		e := LogEntry{Hash: fields[0], Short: fields[1], Author: fields[2], Email: fields[3], Subject: fields[5], Path: path}
+		e.Date, _ = time.Parse(time.RFC3339, fields[4])
+		for _, line := range lines[1:] {
+			if status := strings.Split(line, "\t"); len(status) >= 2 {
+				e.Path = filepath.Join(top, filepath.FromSlash(status[len(status)-1]))
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries[min(skip, len(entries)):], nil
+}
+
+// handleGitLog returns a page of a file's history; diffs are fetched per
+// commit with /api/git/show.
+func handleGitLog(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := gitRepoDir(w)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	path, ok := checkWorkspacePath(w, r, q.Get("path"))
+	if !ok {
+		return
+	}
+	limit := defaultLogLimit
+	if n, err := strconv.Atoi(q.Get("limit")); err == nil && n > 0 {
+		limit = min(n, maxLogLimit)
+	}
+	skip, _ := strconv.Atoi(q.Get("skip"))
+
+	entries, err := fileLog(dir, path, max(skip, 0), limit)
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":    path,
+		"entries": entries,
+		"more":    len(entries) == limit,
+	})
+}
+
+// handleGitShow returns the changes a commit made, limited to one file if
+// path is given (use the entry's path from /api/git/log for renamed files).
+func handleGitShow(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := gitRepoDir(w)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	commit := q.Get("commit")
+	if commit == "" || strings.HasPrefix(commit, "-") {
+		http.Error(w, "Invalid commit", http.StatusBadRequest)
+		return
+	}
+	args := []string{"show", "--format=", "--no-color", "--no-ext-diff", "-M", commit, "--"}
+	if q.Get("path") != "" {
+		path, ok := checkWorkspacePath(w, r, q.Get("path"))
+		if !ok {
+			return
+		}
+		args = append(args, path)
+	}
+
+	out, err := runGit(dir, args...)
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"commit": commit,
+		"diff":   string(out),
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBlame(t *testing.T) {
+	a := strings.Repeat("a", 40)
+	b := strings.Repeat("b", 40)
+	zero := strings.Repeat("0", 40)
+	out := strings.Join([]string{
+		a + " 1 1 2",
+		"author Ann",
+		"author-mail <ann@example.com>",
+		"author-time 1700000000",
+		"author-tz +0000",
+		"summary First commit",
+		"filename f.go",
+		"\tpackage f",
+		a + " 2 2",
+		"\t",
+		b + " 5 3 1",
+		"author Bob",
+		"author-mail <bob@example.com>",
+		"author-time 1700000100",
+		"summary Second",
+		"filename f.go",
+		"\tfunc F() {}",
+		a + " 3 4 1",
+		"\t// back to a",
+		zero + " 5 5 1",
+		"author Not Committed Yet",
+		"author-mail <not.committed.yet>",
+		"summary Version of f.go from f.go",
+		"filename f.go",
+		"\tnew line",
+		"",
+	}, "\n")
+
+	commits, ranges := parseBlame(out)
+	wantRanges := []BlameRange{
+		{Start: 1, End: 2, Commit: a, OrigStart: 1},
+		{Start: 3, End: 3, Commit: b, OrigStart: 5},
+		{Start: 4, End: 4, Commit: a, OrigStart: 3},
+		{Start: 5, End: 5, Commit: zero, OrigStart: 5},
+	}
+	if !reflect.DeepEqual(ranges, wantRanges) {
+		t.Errorf("ranges = %+v, want %+v", ranges, wantRanges)
+	}
+
+	if len(commits) != 3 {
+		t.Fatalf("got %d commits, want 3", len(commits))
+	}
+	want := BlameCommit{Hash: a, Author: "Ann", Email: "ann@example.com", Date: time.Unix(1700000000, 0), Summary: "First commit", Committed: true}
+	if got := *commits[a]; !reflect.DeepEqual(got, want) {
+		t.Errorf("commit a = %+v, want %+v", got, want)
+	}
+	if commits[b].Author != "Bob" || !commits[b].Committed {
+		t.Errorf("commit b = %+v", commits[b])
+	}
+	if commits[zero].Committed {
+		t.Error("the all-zero commit should be uncommitted")
+	}
+
+	if commits, ranges := parseBlame(""); len(commits) != 0 || ranges == nil || len(ranges) != 0 {
+		t.Errorf("parseBlame(\"\") = %v, %v, want no commits and an empty list", commits, ranges)
+	}
+}
@@ -2,4 +2,7 @@ module golangeditor
 
 go 1.24.0
 
-require golang.org/x/text v0.33.0
+require (
+	golang.org/x/mod v0.32.0
+	golang.org/x/text v0.33.0
+)
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/modfile"
+)
+
+const goModTimeout = 5 * time.Minute // go get may have to download
+
+// GoModFile is go.mod in structured form.
+type GoModFile struct {
+	Path      string         `json:"path"`
+	Version   string         `json:"version"` // File version, for edits
+	Module    string         `json:"module"`
+	Go        string         `json:"go,omitempty"`
+	Toolchain string         `json:"toolchain,omitempty"`
+	Require   []GoModRequire `json:"require"`
+	Replace   []GoModReplace `json:"replace"`
+	Exclude   []GoModVersion `json:"exclude"`
+	Retract   []GoModRetract `json:"retract"`
+}
+
+type GoModVersion struct {
+	Path    string `json:"path"`
+	Version string `json:"version,omitempty"` // Empty for a local directory
+}
+
+type GoModRequire struct {
+	Path     string `json:"path"`
+	Version  string `json:"version"`
+	Indirect bool   `json:"indirect"`
+}
+
+type GoModReplace struct {
+	Old GoModVersion `json:"old"`
+	New GoModVersion `json:"new"`
+}
+
+type GoModRetract struct {
+	Low       string `json:"low"`
+	High      string `json:"high"`
+	Rationale string `json:"rationale,omitempty"`
+}
+
+// RequireChange is a requirement a go command added, removed or changed.
+type RequireChange struct {
+	Path string `json:"path"`
+	Old  string `json:"old,omitempty"` // Empty if added
+	New  string `json:"new,omitempty"` // Empty if removed
+}
+
+// goCmdError is a failed go command with its output.
+type goCmdError struct {
+	Args     []string
+	Output   string
+	ExitCode int
+	Err      error
+}
+
+func (e *goCmdError) Error() string {
+	msg := strings.TrimSpace(e.Output)
+	if msg == "" {
+		msg = e.Err.Error()
+	}
+	return "go " + strings.Join(e.Args, " ") + ": " + msg
+}
+
+func (e *goCmdError) Unwrap() error { return e.Err }
+
+// runGo runs the go command in dir, returning standard output. Errors carry
+// standard error, where go reports what went wrong.
+func runGo(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, goModTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, findGoExecutable(), args...)
+	cmd.Dir = dir
+	hideWindow(cmd)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		gerr := &goCmdError{Args: args, Output: stderr.String(), ExitCode: -1, Err: err}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			gerr.ExitCode = exitErr.ExitCode()
+		}
+		return stdout.Bytes(), gerr
+	}
+	return stdout.Bytes(), nil
+}
+
+// writeGoError answers a failed go command like writeGitError does.
+func writeGoError(w http.ResponseWriter, err error) {
+	var gerr *goCmdError
+	if !errors.As(err, &gerr) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":    gerr.Error(),
+		"type":     "go",
+		"command":  "go " + strings.Join(gerr.Args, " "),
+		"stderr":   strings.TrimSpace(gerr.Output),
+		"exitCode": gerr.ExitCode,
+	})
+}
+
+// moduleDir resolves the module a request is about: dir may be the module
+// directory or its go.mod, and defaults to the workspace root.
+func moduleDir(w http.ResponseWriter, r *http.Request, dir string) (string, bool) {
+	if dir == "" {
+		dir = currentWorkDir
+	}
+	dir, ok := checkWorkspacePath(w, r, dir)
+	if !ok {
+		return "", false
+	}
+	if filepath.Base(dir) == "go.mod" {
+		dir = filepath.Dir(dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err != nil {
+		http.Error(w, "No go.mod in "+dir, http.StatusNotFound)
+		return "", false
+	}
+	return dir, true
+}
+
+// readGoMod parses the module's go.mod, returning its file version too.
+func readGoMod(dir string) (*modfile.File, fileVersion, error) {
+	gomod := filepath.Join(dir, "go.mod")
+	data, version, err := readVersioned(gomod)
+	if err != nil {
+		return nil, version, err
+	}
+	mf, err := modfile.Parse(gomod, data, nil)
+	return mf, version, err
+}
+
+// goModJSON converts a parsed go.mod to its JSON form.
+func goModJSON(dir string, mf *modfile.File, version fileVersion) *GoModFile {
+	out := &GoModFile{
+		Path:    filepath.Join(dir, "go.mod"),
+		Version: version.String(),
+		Require: []GoModRequire{},
+		Replace: []GoModReplace{},
+		Exclude: []GoModVersion{},
+		Retract: []GoModRetract{},
+	}
+	if mf.Module != nil {
+		out.Module = mf.Module.Mod.Path
+	}
+	if mf.Go != nil {
+		out.Go = mf.Go.Version
+	}
+	if mf.Toolchain != nil {
+		out.Toolchain = mf.Toolchain.Name
+	}
+	for _, req := range mf.Require {
+		out.Require = append(out.Require, GoModRequire{Path: req.Mod.Path, Version: req.Mod.Version, Indirect: req.Indirect})
+	}
+	for _, rep := range mf.Replace {
+		out.Replace = append(out.Replace, GoModReplace{
+			Old: GoModVersion{Path: rep.Old.Path, Version: rep.Old.Version},
+			New: GoModVersion{Path: rep.New.Path, Version: rep.New.Version},
+		})
+	}
+	for _, ex := range mf.Exclude {
+		out.Exclude = append(out.Exclude, GoModVersion{Path: ex.Mod.Path, Version: ex.Mod.Version})
+	}
+	for _, ret := range mf.Retract {
+		out.Retract = append(out.Retract, GoModRetract{Low: ret.Low, High: ret.High, Rationale: ret.Rationale})
+	}
+	return out
+}
+
+// requireChanges compares the requirements of two versions of go.mod.
+func requireChanges(before, after *modfile.File) []RequireChange {
+	versions := func(mf *modfile.File) map[string]string {
+		m := map[string]string{}
+		if mf != nil {
+			for _, req := range mf.Require {
+				m[req.Mod.Path] = req.Mod.Version
+			}
+		}
+		return m
+	}
+	old, cur := versions(before), versions(after)
+
+	changes := []RequireChange{}
+	if after != nil {
+		for _, req := range after.Require {
+			if v := old[req.Mod.Path]; v != req.Mod.Version {
+				changes = append(changes, RequireChange{Path: req.Mod.Path, Old: v, New: req.Mod.Version})
+			}
+		}
+	}
+	if before != nil {
+		for _, req := range before.Require {
+			if _, ok := cur[req.Mod.Path]; !ok {
+				changes = append(changes, RequireChange{Path: req.Mod.Path, Old: req.Mod.Version})
+			}
+		}
+	}
+	return changes
+}
+
+// handleGoMod returns a module's go.mod in structured form.
+func handleGoMod(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := moduleDir(w, r, r.URL.Query().Get("dir"))
+	if !ok {
+		return
+	}
+	mf, version, err := readGoMod(dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(goModJSON(dir, mf, version))
+}
+
+// runModCommand runs a go command that rewrites go.mod and reports the
+// resulting go.mod and how its requirements changed, then re-indexes.
+func runModCommand(w http.ResponseWriter, r *http.Request, dir string, args ...string) {
+	before, _, _ := readGoMod(dir)
+	if _, err := runGo(r.Context(), dir, args...); err != nil {
+		writeGoError(w, err)
+		return
+	}
+	after, version, err := readGoMod(dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("go %s in %s\n", strings.Join(args, " "), dir)
+	go updateIndex(currentWorkDir) // Re-index
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"gomod":   goModJSON(dir, after, version),
+		"changes": requireChanges(before, after),
+	})
+}
+
+// handleGoModTidy runs go mod tidy.
+func handleGoModTidy(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	var req struct {
+		Dir string `json:"dir"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dir, ok := moduleDir(w, r, req.Dir)
+	if !ok {
+		return
+	}
+	runModCommand(w, r, dir, "mod", "tidy")
+}
+
+// handleGoGet runs go get for packages given as path, path@version or
+// path@none.
+func handleGoGet(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	var req struct {
+		Dir      string   `json:"dir"`
+		Packages []string `json:"packages"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Packages) == 0 {
+		http.Error(w, "packages required", http.StatusBadRequest)
+		return
+	}
+	for _, pkg := range req.Packages {
+		if pkg == "" || strings.HasPrefix(pkg, "-") || strings.ContainsAny(pkg, " \t\n") {
+			http.Error(w, "Invalid package: "+pkg, http.StatusBadRequest)
+			return
+		}
+	}
+	dir, ok := moduleDir(w, r, req.Dir)
+	if !ok {
+		return
+	}
+	runModCommand(w, r, dir, append([]string{"get"}, req.Packages...)...)
+}
+
+// handleGoModGraph returns the module requirement graph as edges between
+// path@version nodes; the main module has no version.
+func handleGoModGraph(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	dir, ok := moduleDir(w, r, r.URL.Query().Get("dir"))
+	if !ok {
+		return
+	}
+	out, err := runGo(r.Context(), dir, "mod", "graph")
+	if err != nil {
+		writeGoError(w, err)
+		return
+	}
+
+	type edge struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	edges := []edge{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if from, to, ok := strings.Cut(strings.TrimSpace(line), " "); ok {
+			edges = append(edges, edge{From: from, To: to})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"edges": edges})
+}
+
+// handleGoModWhy explains why packages (or with module set, modules) are
+// needed: the shortest import chain from the main module to each.
+func handleGoModWhy(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	q := r.URL.Query()
+	dir, ok := moduleDir(w, r, q.Get("dir"))
+	if !ok {
+		return
+	}
+	targets := splitList(q.Get("targets"))
+	if len(targets) == 0 {
+		http.Error(w, "targets required", http.StatusBadRequest)
+		return
+	}
+	for _, t := range targets {
+		if strings.HasPrefix(t, "-") {
+			http.Error(w, "Invalid target: "+t, http.StatusBadRequest)
+			return
+		}
+	}
+	args := []string{"mod", "why"}
+	if q.Get("module") == "true" {
+		args = append(args, "-m")
+	}
+	out, err := runGo(r.Context(), dir, append(args, targets...)...)
+	if err != nil {
+		writeGoError(w, err)
+		return
+	}
+
+	// Output is a "# target" line per target, then the import chain or a
+	// parenthesized note that it isn't needed
+	type why struct {
+		Target string   `json:"target"`
+		Needed bool     `json:"needed"`
+		Chain  []string `json:"chain"`
+		Note   string   `json:"note,omitempty"`
+	}
+	results := []why{}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "# "):
+			results = append(results, why{Target: line[2:], Needed: true, Chain: []string{}})
+		case line == "" || len(results) == 0:
+		case strings.HasPrefix(line, "("):
+			cur := &results[len(results)-1]
+			cur.Needed = false
+			cur.Note = strings.Trim(line, "()")
+		default:
+			cur := &results[len(results)-1]
+			cur.Chain = append(cur.Chain, line)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// GoModEdit is one change to go.mod. Op is "require" (add or update),
+// "droprequire", "replace", "dropreplace", "exclude" or "dropexclude".
+// For a replace, Path and Version name the replaced module (Version empty
+// for all versions) and NewPath and NewVersion the replacement, NewVersion
+// empty for a local directory.
+type GoModEdit struct {
+	Op         string `json:"op"`
+	Path       string `json:"path"`
+	Version    string `json:"version"`
+	Indirect   bool   `json:"indirect"` // For new requirements
+	NewPath    string `json:"newPath"`
+	NewVersion string `json:"newVersion"`
+}
+
+// GoModProblem is an edit that failed validation.
+type GoModProblem struct {
+	Edit  int    `json:"edit"` // Index into the request's edits
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// AffectedPackage is a workspace package importing a module an edit changed.
+type AffectedPackage struct {
+	ImportPath string   `json:"importPath"`
+	Dir        string   `json:"dir"`
+	Imports    []string `json:"imports"` // The imports from changed modules
+}
+
+// cachedModule reports whether path@version has been downloaded to the
+// module cache, which is what the go command needs to build with it.
+func cachedModule(path, version string) error {
+	cache := goModCache()
+	if cache == "" {
+		return fmt.Errorf("no module cache")
+	}
+	escPath, err := module.EscapePath(path)
+	if err != nil {
+		return err
+	}
+	escVer, err := module.EscapeVersion(version)
+	if err != nil {
+		return err
+	}
+	mod := filepath.Join(cache, "cache", "download", filepath.FromSlash(escPath), "@v", escVer+".mod")
+	if _, err := os.Stat(mod); err != nil {
+		return fmt.Errorf("%s@%s is not in the module cache; fetch it with /api/gomod/get", path, version)
+	}
+	return nil
+}
+
+// checkModuleVersion validates a module path and version and checks that
+// the version is in the module cache.
+func checkModuleVersion(path, version string) error {
+	if err := module.Check(path, version); err != nil {
+		return err
+	}
+	return cachedModule(path, version)
+}
+
+// validateEdit checks an edit before it is applied; dir is the module's
+// directory, which local replacements are relative to.
+func validateEdit(dir string, e GoModEdit) error {
+	if err := module.CheckPath(e.Path); err != nil {
+		return err
+	}
+	switch e.Op {
+	case "require":
+		return checkModuleVersion(e.Path, e.Version)
+	case "exclude":
+		return module.Check(e.Path, e.Version) // Excluded versions need not exist
+	case "replace":
+		if e.Version != "" {
+			if err := module.Check(e.Path, e.Version); err != nil {
+				return err
+			}
+		}
+		if e.NewPath == "" {
+			return fmt.Errorf("replacement required")
+		}
+		if e.NewVersion != "" {
+			return checkModuleVersion(e.NewPath, e.NewVersion)
+		}
+		if !modfile.IsDirectoryPath(e.NewPath) {
+			return fmt.Errorf("replacement %s needs a version or must be a directory path like ./%s", e.NewPath, e.NewPath)
+		}
+		if _, err := os.Stat(filepath.Join(resolveModuleDir(dir, e.NewPath), "go.mod")); err != nil {
+			return fmt.Errorf("replacement directory %s has no go.mod", e.NewPath)
+		}
+	case "droprequire", "dropreplace", "dropexclude":
+	default:
+		return fmt.Errorf("unknown op %q", e.Op)
+	}
+	return nil
+}
+
+// applyEdit applies a validated edit. modfile edits the syntax tree in
+// place, so comments and formatting of untouched lines are kept.
+func applyEdit(mf *modfile.File, e GoModEdit) error {
+	switch e.Op {
+	case "require":
+		for _, req := range mf.Require {
+			if req.Mod.Path == e.Path {
+				return mf.AddRequire(e.Path, e.Version)
+			}
+		}
+		mf.AddNewRequire(e.Path, e.Version, e.Indirect)
+	case "droprequire":
+		return mf.DropRequire(e.Path)
+	case "replace":
+		return mf.AddReplace(e.Path, e.Version, e.NewPath, e.NewVersion)
+	case "dropreplace":
+		return mf.DropReplace(e.Path, e.Version)
+	case "exclude":
+		return mf.AddExclude(e.Path, e.Version)
+	case "dropexclude":
+		return mf.DropExclude(e.Path, e.Version)
+	}
+	return nil
+}
+
+// affectedPackages returns the packages of the module in dir that import
+// from any of the changed module paths. Each import is attributed to the
+// longest module path it falls under, so example.com/m/v2 isn't taken for
+// example.com/m.
+func affectedPackages(dir string, modPaths []string, changed map[string]bool) []AffectedPackage {
+	owner := func(imp string) string {
+		best := ""
+		for _, p := range modPaths {
+			if (imp == p || strings.HasPrefix(imp, p+"/")) && len(p) > len(best) {
+				best = p
+			}
+		}
+		return best
+	}
+
+	affected := []AffectedPackage{}
+	layout := snapshotLayout()
+	if layout == nil {
+		return affected
+	}
+	for _, mod := range layout.Modules {
+		if !sameFile(mod.Dir, dir) {
+			continue
+		}
+		for _, pkg := range mod.Packages {
+			var imports []string
+			for _, imp := range pkg.Imports {
+				if changed[owner(imp)] {
+					imports = append(imports, imp)
+				}
+			}
+			if len(imports) > 0 {
+				affected = append(affected, AffectedPackage{ImportPath: pkg.ImportPath, Dir: pkg.Dir, Imports: imports})
+			}
+		}
+	}
+	return affected
+}
+
+// handleGoModEdit applies structured edits to go.mod. All edits are
+// validated first, and go.mod is only written if every one is valid. With a
+// version, the edit is refused (409) if go.mod changed since it was read.
+func handleGoModEdit(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	var req struct {
+		Dir     string      `json:"dir"`
+		Version string      `json:"version"`
+		Edits   []GoModEdit `json:"edits"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Edits) == 0 {
+		http.Error(w, "edits required", http.StatusBadRequest)
+		return
+	}
+	dir, ok := moduleDir(w, r, req.Dir)
+	if !ok {
+		return
+	}
+	mf, _, err := readGoMod(dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	problems := []GoModProblem{}
+	for i, e := range req.Edits {
+		if err := validateEdit(dir, e); err != nil {
+			problems = append(problems, GoModProblem{Edit: i, Path: e.Path, Error: err.Error()})
+		}
+	}
+	if len(problems) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    "Invalid go.mod edits",
+			"type":     "validation",
+			"problems": problems,
+		})
+		return
+	}
+
+	// Module paths before the edits, so dropped requirements still own
+	// their imports when working out what is affected
+	var modPaths []string
+	for _, m := range mf.Require {
+		modPaths = append(modPaths, m.Mod.Path)
+	}
+	changed := map[string]bool{}
+	for i, e := range req.Edits {
+		if err := applyEdit(mf, e); err != nil {
+			http.Error(w, fmt.Sprintf("edit %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		changed[e.Path] = true
+		modPaths = append(modPaths, e.Path)
+	}
+	mf.Cleanup()
+	data, err := mf.Format()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	gomod := filepath.Join(dir, "go.mod")
+	version, err := saveWorkspaceFile(gomod, string(data), "", req.Version)
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	log.Printf("Edited %s\n", gomod)
+	affected := affectedPackages(dir, modPaths, changed)
+	go updateIndex(currentWorkDir) // Re-index
+
+	resp := map[string]interface{}{
+		"status":   "ok",
+		"gomod":    goModJSON(dir, mf, version),
+		"content":  string(data),
+		"affected": affected,
+		"needsSum": false,
+	}
+	if err := updateGoSum(r.Context(), dir, req.Edits); err != nil {
+		// go.mod is written either way; the client can fix go.sum with tidy
+		log.Printf("Update go.sum in %s: %v\n", dir, err)
+		resp["needsSum"] = true
+		resp["sumError"] = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// updateGoSum records the checksums of the module versions the edits
+// require or replace with in go.sum. The versions are already in the module
+// cache, so go mod download only has to hash them.
+func updateGoSum(ctx context.Context, dir string, edits []GoModEdit) error {
+	args := []string{"mod", "download"}
+	for _, e := range edits {
+		switch {
+		case e.Op == "require":
+			args = append(args, e.Path+"@"+e.Version)
+		case e.Op == "replace" && e.NewVersion != "":
+			args = append(args, e.NewPath+"@"+e.NewVersion)
+		}
+	}
+	if len(args) == 2 {
+		return nil
+	}
+	_, err := runGo(ctx, dir, args...)
+	return err
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/modfile"
+)
+
+const testGoMod = `module example.com/m
+
+go 1.24
+
+require (
+	example.com/a v1.0.0 // keep this comment
+	example.com/b v1.2.0 // indirect
+)
+
+exclude example.com/c v0.1.0
+`
+
+func TestApplyEdit(t *testing.T) {
+	tests := []struct {
+		name      string
+		edit      GoModEdit
+		contains  []string
+		missing   []string
+		wantError bool
+	}{
+		{
+			name:     "update keeps comment",
+			edit:     GoModEdit{Op: "require", Path: "example.com/a", Version: "v1.1.0"},
+			contains: []string{"example.com/a v1.1.0 // keep this comment"},
+			missing:  []string{"v1.0.0"},
+		},
+		{
+			name:     "new requirement",
+			edit:     GoModEdit{Op: "require", Path: "example.com/new", Version: "v0.3.0"},
+			contains: []string{"example.com/new v0.3.0", "example.com/a v1.0.0 // keep this comment"},
+		},
+		{
+			name:     "new indirect requirement",
+			edit:     GoModEdit{Op: "require", Path: "example.com/new", Version: "v0.3.0", Indirect: true},
+			contains: []string{"example.com/new v0.3.0 // indirect"},
+		},
+		{
+			name:    "drop requirement",
+			edit:    GoModEdit{Op: "droprequire", Path: "example.com/b"},
+			missing: []string{"example.com/b"},
+		},
+		{
+			name:     "replace with a directory",
+			edit:     GoModEdit{Op: "replace", Path: "example.com/a", NewPath: "../a"},
+			contains: []string{"replace example.com/a => ../a"},
+		},
+		{
+			name:     "replace one version with a module",
+			edit:     GoModEdit{Op: "replace", Path: "example.com/a", Version: "v1.0.0", NewPath: "example.com/fork", NewVersion: "v1.0.1"},
+			contains: []string{"replace example.com/a v1.0.0 => example.com/fork v1.0.1"},
+		},
+		{
+			name:     "exclude",
+			edit:     GoModEdit{Op: "exclude", Path: "example.com/b", Version: "v1.1.0"},
+			contains: []string{"example.com/b v1.1.0", "example.com/c v0.1.0"},
+		},
+		{
+			name:    "drop exclude",
+			edit:    GoModEdit{Op: "dropexclude", Path: "example.com/c", Version: "v0.1.0"},
+			missing: []string{"example.com/c"},
+		},
+	}
+	for _, tt := range tests {
+		mf, err := modfile.Parse("go.mod", []byte(testGoMod), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := applyEdit(mf, tt.edit); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		mf.Cleanup()
+		data, err := mf.Format()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got := string(data)
+		for _, s := range tt.contains {
+			if !strings.Contains(got, s) {
+				t.Errorf("%s: go.mod lacks %q:\n%s", tt.name, s, got)
+			}
+		}
+		for _, s := range tt.missing {
+			if strings.Contains(got, s) {
+				t.Errorf("%s: go.mod still has %q:\n%s", tt.name, s, got)
+			}
+		}
+		if !strings.HasPrefix(got, "module example.com/m\n\ngo 1.24\n") {
+			t.Errorf("%s: header changed:\n%s", tt.name, got)
+		}
+	}
+}
+
+func TestApplyEditDropReplace(t *testing.T) {
+	mf, err := modfile.Parse("go.mod", []byte(testGoMod+"\nreplace example.com/a => ../a\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyEdit(mf, GoModEdit{Op: "dropreplace", Path: "example.com/a"}); err != nil {
+		t.Fatal(err)
+	}
+	mf.Cleanup()
+	data, _ := mf.Format()
+	if strings.Contains(string(data), "replace") {
+		t.Errorf("replace not dropped:\n%s", data)
+	}
+}
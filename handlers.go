@@ -2,20 +2,22 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
 	"io"
-	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
-	"syscall"
+	"sync"
+	"time"
 
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/transform"
@@ -24,13 +26,15 @@ import (
 // Request/Response structs
 type RunRequest struct {
 	Code    string            `json:"code"`
-	Path    string            `json:"path"` // Path to the file being run (optional)
-	Env     map[string]string `json:"env"`  // Custom GOROOT, GOPATH, GOPROXY
+	Path    string            `json:"path"`    // Path to the file being run (optional)
+	Version string            `json:"version"` // Version of Path the code is based on (optional)
+	Env     map[string]string `json:"env"`     // Custom GOROOT, GOPATH, GOPROXY
 }
 
 type RunResponse struct {
-	Output string `json:"output"`
-	Error  string `json:"error"`
+	Output  string `json:"output"`
+	Error   string `json:"error"`
+	Version string `json:"version,omitempty"` // New version of Path after the implicit save
 }
 
 type CmdRequest struct {
@@ -46,27 +50,38 @@ type EnvResponse struct {
 }
 
 type Config struct {
-	LastWorkDir string `json:"lastWorkDir"`
+	LastWorkDir    string      `json:"lastWorkDir"`
+	IndexVendor    bool        `json:"indexVendor"`   // Also index vendor/ of each module
+	IndexReplaced  bool        `json:"indexReplaced"` // Also index the targets of replace directives
+	Target         BuildTarget `json:"target"`
+	AllowedRoots   []string    `json:"allowedRoots"`   // Extra directories the fs endpoints may access
+	AllowedOrigins []string    `json:"allowedOrigins"` // Extra origins allowed to call the API, e.g. the Vite dev server
+
+	HistoryMaxSnapshots int `json:"historyMaxSnapshots"` // Per file; 0 uses the default
+	HistoryMaxDays      int `json:"historyMaxDays"`      // 0 uses the default
+
+	ExcludeGlobs []string `json:"excludeGlobs"` // Paths hidden from the tree, search and index; null uses the default
+	ShowHidden   bool     `json:"showHidden"`   // Show dot-files in the tree and search
 }
 
 var (
+	config         Config
 	currentWorkDir string
 	configFile     = "editor_config.json"
 )
 
 func saveConfig() {
-	cfg := Config{LastWorkDir: currentWorkDir}
-	data, _ := json.MarshalIndent(cfg, "", "  ")
+	config.LastWorkDir = currentWorkDir
+	data, _ := json.MarshalIndent(config, "", "  ")
 	os.WriteFile(configFile, data, 0644)
 }
 
 func loadConfig() {
 	data, err := os.ReadFile(configFile)
 	if err == nil {
-		var cfg Config
-		if err := json.Unmarshal(data, &cfg); err == nil {
-			if info, err := os.Stat(cfg.LastWorkDir); err == nil && info.IsDir() {
-				currentWorkDir = cfg.LastWorkDir
+		if err := json.Unmarshal(data, &config); err == nil {
+			if info, err := os.Stat(config.LastWorkDir); err == nil && info.IsDir() {
+				currentWorkDir = config.LastWorkDir
 			}
 		}
 	}
@@ -74,8 +89,10 @@ func loadConfig() {
 
 // Optimization: Global symbol cache
 var (
-	symbolCache []Symbol
-	cacheMutex  = &strings.Builder{} // Using strictly as a dummy mutex, but usually sync.Mutex is better.
+	symbolCache     []Symbol
+	symbolVersion   uint64 // Bumped every time the index is rebuilt
+	workspaceLayout *WorkspaceLayout
+	cacheMutex      sync.RWMutex
 )
 
 type Symbol struct {
@@ -84,98 +101,235 @@ type Symbol struct {
 	Path      string `json:"path"`
 	Line      int    `json:"line"`
 	Character int    `json:"character"`
+	Package   string `json:"package,omitempty"` // Import path
+	Module    string `json:"module,omitempty"`
+	// Set when the file is excluded for the current build target, i.e. the
+	// symbol only exists under other constraints.
+	Excluded   bool   `json:"excluded,omitempty"`
+	Constraint string `json:"constraint,omitempty"`
 }
 
+// indexMutex serializes index builds so incremental updates don't race
+// with full ones.
+var indexMutex sync.Mutex
+
 func updateIndex(root string) {
+	indexMutex.Lock()
+	defer indexMutex.Unlock()
+
 	log.Println("Indexing symbols in:", root)
-	var symbols []Symbol
+	layout := scanWorkspace(root, indexBuildContext())
+	active, excluded := indexSymbols(layout, nil)
+	// Symbols for other targets go last so lookups by name prefer the active variant
+	symbols := append(active, excluded...)
 
-	fset := token.NewFileSet()
+	storeIndex(layout, symbols)
+	log.Printf("Indexed %d symbols in %d modules\n", len(symbols), len(layout.Modules))
+}
 
-	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return nil
+// updateIndexPaths re-indexes after the given paths were created, changed,
+// renamed or deleted. A Go file only has its package directory rescanned; a
+// directory, go.mod or go.work can add or move packages and modules, so it
+// rescans the whole workspace. Other paths leave the index alone.
+func updateIndexPaths(root string, paths ...string) {
+	indexMutex.Lock()
+	defer indexMutex.Unlock()
+
+	prev := snapshotLayout()
+	full := prev == nil
+	var dirs []string
+	for _, p := range paths {
+		switch name := filepath.Base(p); {
+		case filepath.Ext(name) == ".go":
+			dirs = append(dirs, filepath.Dir(p))
+		case name == "go.mod" || name == "go.work" || indexedDir(prev, p):
+			full = true
 		}
-		if d.IsDir() {
-			if strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules" || d.Name() == "vendor" {
-				return filepath.SkipDir
+	}
+	if !full && len(dirs) == 0 {
+		return
+	}
+
+	changed := func(p string) bool {
+		for _, c := range paths {
+			if pathWithin(c, p) {
+				return true
 			}
-			return nil
 		}
-		if !strings.HasSuffix(path, ".go") {
-			return nil
+		return false
+	}
+
+	var layout *WorkspaceLayout
+	if !full {
+		layout = rescanPackages(prev, dirs, indexBuildContext())
+	}
+	if layout == nil {
+		layout = scanWorkspace(root, indexBuildContext())
+	}
+	active, excluded := indexSymbols(layout, changed)
+
+	old, _ := snapshotSymbols()
+	var keptActive, keptExcluded []Symbol
+	for _, sym := range old {
+		switch {
+		case changed(sym.Path):
+		case sym.Excluded:
+			keptExcluded = append(keptExcluded, sym)
+		default:
+			keptActive = append(keptActive, sym)
 		}
+	}
+	symbols := append(append(append(keptActive, active...), keptExcluded...), excluded...)
 
-		// Parse file
-		f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
-		if err != nil {
-			return nil
+	storeIndex(layout, symbols)
+	log.Printf("Re-indexed %d paths, %d symbols\n", len(paths), len(symbols))
+}
+
+// indexedDir reports whether p is a directory now, or was one holding
+// packages or modules of the layout before it went away.
+func indexedDir(layout *WorkspaceLayout, p string) bool {
+	if info, err := os.Stat(p); err == nil {
+		return info.IsDir()
+	}
+	if layout == nil {
+		return false
+	}
+	for _, mod := range layout.Modules {
+		if pathWithin(p, mod.Dir) {
+			return true
+		}
+		for _, pkg := range mod.Packages {
+			if pathWithin(p, pkg.Dir) {
+				return true
+			}
 		}
+	}
+	return false
+}
 
-		// Collect functions
-		for _, decl := range f.Decls {
-			if fn, ok := decl.(*ast.FuncDecl); ok {
-				pos := fset.Position(fn.Pos())
-				kind := "Function"
-				if fn.Recv != nil {
-					kind = "Method"
+func storeIndex(layout *WorkspaceLayout, symbols []Symbol) {
+	cacheMutex.Lock()
+	symbolCache = symbols
+	workspaceLayout = layout
+	symbolVersion++
+	cacheMutex.Unlock()
+}
+
+// indexSymbols collects the symbols of every file in the layout accepted by
+// include (all files if nil), split into those matching the build target
+// and those excluded by constraints.
+func indexSymbols(layout *WorkspaceLayout, include func(path string) bool) (active, excluded []Symbol) {
+	fset := token.NewFileSet()
+	for _, mod := range layout.Modules {
+		for _, pkg := range mod.Packages {
+			for _, path := range pkg.indexedFiles() {
+				if include != nil && !include(path) {
+					continue
+				}
+				for _, sym := range fileSymbols(fset, path) {
+					sym.Package = pkg.ImportPath
+					sym.Module = mod.Path
+					active = append(active, sym)
 				}
-				symbols = append(symbols, Symbol{
-					Name:      fn.Name.Name,
-					Kind:      kind,
-					Path:      path,
-					Line:      pos.Line,
-					Character: pos.Column,
-				})
 			}
-			if gen, ok := decl.(*ast.GenDecl); ok {
-				for _, spec := range gen.Specs {
-					if typeSpec, ok := spec.(*ast.TypeSpec); ok {
-						pos := fset.Position(typeSpec.Pos())
+			for _, name := range pkg.IgnoredFiles {
+				path := filepath.Join(pkg.Dir, name)
+				if include != nil && !include(path) {
+					continue
+				}
+				constraint := fileConstraint(path)
+				for _, sym := range fileSymbols(fset, path) {
+					sym.Package = pkg.ImportPath
+					sym.Module = mod.Path
+					sym.Excluded = true
+					sym.Constraint = constraint
+					excluded = append(excluded, sym)
+				}
+			}
+		}
+	}
+	return active, excluded
+}
+
+// fileSymbols parses a Go file and returns its top-level declarations.
+func fileSymbols(fset *token.FileSet, path string) []Symbol {
+	f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+
+	var symbols []Symbol
+	// Collect functions
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			pos := fset.Position(fn.Pos())
+			kind := "Function"
+			if fn.Recv != nil {
+				kind = "Method"
+			}
+			symbols = append(symbols, Symbol{
+				Name:      fn.Name.Name,
+				Kind:      kind,
+				Path:      path,
+				Line:      pos.Line,
+				Character: pos.Column,
+			})
+		}
+		if gen, ok := decl.(*ast.GenDecl); ok {
+			for _, spec := range gen.Specs {
+				if typeSpec, ok := spec.(*ast.TypeSpec); ok {
+					pos := fset.Position(typeSpec.Pos())
+					symbols = append(symbols, Symbol{
+						Name:      typeSpec.Name.Name,
+						Kind:      "Struct",
+						Path:      path,
+						Line:      pos.Line,
+						Character: pos.Column,
+					})
+				}
+				if valSpec, ok := spec.(*ast.ValueSpec); ok {
+					for _, name := range valSpec.Names {
+						pos := fset.Position(name.Pos())
+						kind := "Variable"
+						if gen.Tok == token.CONST {
+							kind = "Constant"
+						}
 						symbols = append(symbols, Symbol{
-							Name:      typeSpec.Name.Name,
-							Kind:      "Struct",
+							Name:      name.Name,
+							Kind:      kind,
 							Path:      path,
 							Line:      pos.Line,
 							Character: pos.Column,
 						})
 					}
-					if valSpec, ok := spec.(*ast.ValueSpec); ok {
-						for _, name := range valSpec.Names {
-							pos := fset.Position(name.Pos())
-							kind := "Variable"
-							if gen.Tok == token.CONST {
-								kind = "Constant"
-							}
-							symbols = append(symbols, Symbol{
-								Name:      name.Name,
-								Kind:      kind,
-								Path:      path,
-								Line:      pos.Line,
-								Character: pos.Column,
-							})
-						}
-					}
 				}
 			}
 		}
-		return nil
-	})
-
-	symbolCache = symbols
-	log.Printf("Indexed %d symbols\n", len(symbols))
+	}
+	return symbols
 }
 
 func handleSymbols(w http.ResponseWriter, r *http.Request) {
 	enableCors(&w)
-	json.NewEncoder(w).Encode(symbolCache)
+	symbols, version := snapshotSymbols()
+	if checkNotModified(w, r, version) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(symbols)
 }
 
 type FileNode struct {
-	Name     string     `json:"name"`
-	Path     string     `json:"path"`
-	IsDir    bool       `json:"isDir"`
-	Children []FileNode `json:"children,omitempty"`
+	Name      string     `json:"name"`
+	Path      string     `json:"path"`
+	IsDir     bool       `json:"isDir"`
+	Size      int64      `json:"size"`
+	ModTime   time.Time  `json:"mtime"`
+	Mode      string     `json:"mode"`
+	Symlink   string     `json:"symlink,omitempty"`   // Link target, for symlinks
+	GitStatus string     `json:"gitStatus,omitempty"` // See gitFileStatus.Marker
+	HasGoMod  bool       `json:"hasGoMod,omitempty"`
+	Children  []FileNode `json:"children,omitempty"`
 }
 
 func handleSetWorkDir(w http.ResponseWriter, r *http.Request) {
@@ -192,8 +346,13 @@ func handleSetWorkDir(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	path, ok := checkWorkDir(w, r, req.Path)
+	if !ok {
+		return
+	}
+
 	// Verify the path exists and is a directory
-	info, err := os.Stat(req.Path)
+	info, err := os.Stat(path)
 	if err != nil {
 		http.Error(w, "Path does not exist: "+err.Error(), http.StatusBadRequest)
 		return
@@ -203,9 +362,10 @@ func handleSetWorkDir(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	currentWorkDir = req.Path
+	currentWorkDir = path
 	saveConfig()
 	go updateIndex(currentWorkDir) // Re-index
+	watchWorkspace(currentWorkDir)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "path": currentWorkDir})
 }
@@ -227,9 +387,7 @@ func handlePickDir(w http.ResponseWriter, r *http.Request) {
 	}
 	`
 	cmd := exec.Command("powershell", "-NoProfile", "-Command", psScript)
-	if runtime.GOOS == "windows" {
-		cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
-	}
+	hideWindow(cmd)
 	output, err := cmd.CombinedOutput()
 
 	path := strings.TrimSpace(string(output))
@@ -238,11 +396,16 @@ func handlePickDir(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]string{"status": "cancelled"})
 		return
 	}
+	path, ok := checkWorkDir(w, r, path)
+	if !ok {
+		return
+	}
 
 	// Set as work dir immediately
 	currentWorkDir = path
 	saveConfig()
 	go updateIndex(currentWorkDir) // Re-index
+	watchWorkspace(currentWorkDir)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "path": path})
 }
@@ -267,25 +430,26 @@ func handleListFiles(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	files, err := os.ReadDir(rootPath)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	rootPath, ok := checkWorkspacePath(w, r, rootPath)
+	if !ok {
 		return
 	}
 
-	var nodes []FileNode
-	for _, f := range files {
-		if strings.HasPrefix(f.Name(), ".") {
-			continue // skip hidden files
-		}
+	q := r.URL.Query()
+	depth := 1
+	if n, err := strconv.Atoi(q.Get("depth")); err == nil && n > 0 {
+		depth = min(n, maxListDepth)
+	}
+	lister := &dirLister{
+		ignore: newIgnoreEngine(currentWorkDir),
+		git:    cachedGitStatusMarkers(rootPath),
+		less:   fileNodeLess(q.Get("sort"), q.Get("order") == "desc"),
+	}
 
-		fullPath := filepath.Join(rootPath, f.Name())
-		node := FileNode{
-			Name:  f.Name(),
-			Path:  fullPath,
-			IsDir: f.IsDir(),
-		}
-		nodes = append(nodes, node)
+	nodes, err := lister.list(rootPath, depth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -303,15 +467,35 @@ func handleReadFile(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Path required", http.StatusBadRequest)
 		return
 	}
+	path, ok := checkWorkspacePath(w, r, path)
+	if !ok {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if info.IsDir() {
+		http.Error(w, "Path is a directory", http.StatusBadRequest)
+		return
+	}
+	// Binary and very large files are sent a page at a time
+	if readChunk(w, r, path, info) {
+		return
+	}
 
-	content, err := os.ReadFile(path)
+	content, version, err := readVersioned(path)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	text, encoding := decodeFile(content)
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"content": string(content)})
+	json.NewEncoder(w).Encode(map[string]string{"content": text, "version": version.String(), "encoding": encoding})
 }
 
 func handleResolveFile(w http.ResponseWriter, r *http.Request) {
@@ -327,6 +511,10 @@ func handleResolveFile(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "base and import required", http.StatusBadRequest)
 		return
 	}
+	basePath, ok := checkWorkspacePath(w, r, basePath)
+	if !ok {
+		return
+	}
 
 	dir := filepath.Dir(basePath)
 	resolved := ""
@@ -353,6 +541,11 @@ func handleResolveFile(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if resolved != "" && !isWorkspaceFile(resolved) {
+		log.Printf("Rejected %s %s: resolved %s is outside the workspace\n", r.Method, r.URL.Path, resolved)
+		resolved = ""
+	}
+
 	if resolved != "" {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"path": resolved})
@@ -380,30 +573,36 @@ func handleSaveFile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Path    string `json:"path"`
-		Content string `json:"content"`
+		Path     string `json:"path"`
+		Content  string `json:"content"`
+		Version  string `json:"version"`  // From the read; empty skips the conflict check
+		Encoding string `json:"encoding"` // Empty keeps the file's encoding
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if err := os.WriteFile(req.Path, []byte(req.Content), 0644); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	path, ok := checkWorkspacePath(w, r, req.Path)
+	if !ok {
 		return
 	}
+	req.Path = path
 
-	if strings.HasSuffix(req.Path, ".go") && currentWorkDir != "" {
-		go updateIndex(currentWorkDir)
+	version, err := saveWorkspaceFile(req.Path, req.Content, req.Encoding, req.Version)
+	if err != nil {
+		writeSaveError(w, err)
+		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	// The watcher re-indexes the file once it sees the write
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "version": version.String()})
 }
 
 func enableCors(w *http.ResponseWriter) {
-	(*w).Header().Set("Access-Control-Allow-Origin", "*")
+	// Access-Control-Allow-Origin is set by requireAPIAuth for allowed origins only
 	(*w).Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type, "+tokenHeader)
 }
 
 func getGoBin(env map[string]string) string {
@@ -487,20 +686,33 @@ func handleRun(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var runFile string
+	var runFile, savedVersion string
 	var cleanup func()
 
 	// Determine go binary path
 	goBin := getGoBin(req.Env)
 
 	if req.Path != "" {
+		path, ok := checkWorkspacePath(w, r, req.Path)
+		if !ok {
+			return
+		}
+		req.Path = path
+
 		// If path is provided, we run the actual file.
 		// First, we ensure the file content is up to date with what's in the editor
 		// This overwrites the file on disk, which is usually expected behavior for "Run"
-		if err := os.WriteFile(req.Path, []byte(req.Code), 0644); err != nil {
+		version, err := saveWorkspaceFile(req.Path, req.Code, "", req.Version)
+		if err != nil {
+			var conflict *conflictError
+			if errors.As(err, &conflict) {
+				writeSaveError(w, err)
+				return
+			}
 			json.NewEncoder(w).Encode(RunResponse{Error: "Failed to save file before running: " + err.Error()})
 			return
 		}
+		savedVersion = version.String()
 		runFile = req.Path
 		cleanup = func() {} // No cleanup needed for actual file
 	} else {
@@ -527,11 +739,7 @@ func handleRun(w http.ResponseWriter, r *http.Request) {
 
 	// Set working directory to project root or file directory
 	if req.Path != "" {
-		// Update index if it's a Go file
-		if strings.HasSuffix(req.Path, ".go") && currentWorkDir != "" {
-			go updateIndex(currentWorkDir)
-		}
-
+		// The watcher re-indexes the saved file
 		cmd.Dir = filepath.Dir(req.Path)
 		// If we are in the root of a module, running 'go run main.go' works.
 		// If currentWorkDir is set, we might want to run from there if it's the module root.
@@ -554,7 +762,7 @@ func handleRun(w http.ResponseWriter, r *http.Request) {
 	}
 
 	output, err := cmd.CombinedOutput()
-	response := RunResponse{Output: decodeOutput(output)}
+	response := RunResponse{Output: decodeOutput(output), Version: savedVersion}
 	if err != nil {
 		response.Error = err.Error()
 		if len(output) == 0 {
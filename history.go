@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retention defaults for the local history, overridable in the config.
+const (
+	defaultHistoryMaxSnapshots = 50
+	defaultHistoryMaxDays      = 30
+	maxSnapshotSize            = 10 << 20 // Larger files are not snapshotted
+	historyDiffContext         = 3
+)
+
+// Snapshot is one saved previous version of a file. ID is the snapshot time
+// in Unix nanoseconds.
+type Snapshot struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"`
+}
+
+// historyDir returns the directory holding the snapshots of path:
+// .gofast/history/<hash of the resolved path>. The path itself is recorded
+// in a "path" file so the store can be browsed by hand.
+func historyDir(path string) (string, error) {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	base, err := workspaceDataDir("history")
+	if err != nil {
+		return "", err
+	}
+	key := path
+	if runtime.GOOS == "windows" {
+		key = strings.ToLower(key)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(base, hex.EncodeToString(sum[:8])), nil
+}
+
+// snapshotFile records content as the previous version of path and applies
+// the retention limits. Content equal to the newest snapshot is not stored
+// again.
+func snapshotFile(path string, content []byte) error {
+	if len(content) > maxSnapshotSize {
+		return nil
+	}
+	dir, err := historyDir(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	os.WriteFile(filepath.Join(dir, "path"), []byte(path), 0644)
+
+	snaps, err := listSnapshots(dir)
+	if err != nil {
+		return err
+	}
+	if len(snaps) > 0 {
+		if last, err := os.ReadFile(snapshotPath(dir, snaps[0].ID)); err == nil && bytes.Equal(last, content) {
+			return nil
+		}
+	}
+
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := os.WriteFile(snapshotPath(dir, id), content, 0644); err != nil {
+		return err
+	}
+	return pruneSnapshots(dir)
+}
+
+func snapshotPath(dir, id string) string {
+	return filepath.Join(dir, id+".snap")
+}
+
+// listSnapshots returns the snapshots in dir, newest first.
+func listSnapshots(dir string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snaps []Snapshot
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".snap")
+		if !ok {
+			continue
+		}
+		nanos, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		snaps = append(snaps, Snapshot{ID: id, Time: time.Unix(0, nanos), Size: info.Size()})
+	}
+	slices.SortFunc(snaps, func(a, b Snapshot) int { return b.Time.Compare(a.Time) })
+	return snaps, nil
+}
+
+// pruneSnapshots drops snapshots beyond the configured count or age.
+func pruneSnapshots(dir string) error {
+	maxSnapshots := config.HistoryMaxSnapshots
+	if maxSnapshots <= 0 {
+		maxSnapshots = defaultHistoryMaxSnapshots
+	}
+	maxDays := config.HistoryMaxDays
+	if maxDays <= 0 {
+		maxDays = defaultHistoryMaxDays
+	}
+	cutoff := time.Now().AddDate(0, 0, -maxDays)
+
+	snaps, err := listSnapshots(dir)
+	if err != nil {
+		return err
+	}
+	for i, s := range snaps {
+		if i >= maxSnapshots || s.Time.Before(cutoff) {
+			os.Remove(snapshotPath(dir, s.ID))
+		}
+	}
+	return nil
+}
+
+// readSnapshot returns the content of one snapshot of path.
+func readSnapshot(path, id string) ([]byte, error) {
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return nil, errors.New("invalid snapshot id")
+	}
+	dir, err := historyDir(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(snapshotPath(dir, id))
+}
+
+// handleHistoryList lists the snapshots of a file, newest first.
+func handleHistoryList(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	path, ok := checkWorkspacePath(w, r, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+	dir, err := historyDir(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	snaps, err := listSnapshots(dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if snaps == nil {
+		snaps = []Snapshot{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snaps)
+}
+
+// handleHistoryDiff diffs a snapshot against the file's current content.
+func handleHistoryDiff(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	path, ok := checkWorkspacePath(w, r, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	old, err := readSnapshot(path, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	oldText, _ := decodeFile(old)
+	currentText, _ := decodeFile(current)
+	hunks := diffHunks(diffLines(splitLines(oldText), splitLines(currentText)), historyDiffContext)
+	if hunks == nil {
+		hunks = []DiffHunk{}
+	}
+	name := filepath.Base(path)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      id,
+		"content": oldText,
+		"hunks":   hunks,
+		"diff":    unifiedDiff(name+"@"+id, name, hunks),
+	})
+}
+
+// handleHistoryRestore writes a snapshot back to the file byte for byte. The
+// content being replaced is snapshotted first, so a restore can itself be
+// undone.
+func handleHistoryRestore(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	var req struct {
+		Path    string `json:"path"`
+		ID      string `json:"id"`
+		Version string `json:"version"` // Optional, as for save
+	}
+	if !decodeFsRequest(w, r, &req, &req.Path) {
+		return
+	}
+	content, err := readSnapshot(req.Path, req.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	version, err := writeWorkspaceBytes(req.Path, content, req.Version)
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+
+	text, encoding := decodeFile(content)
+	go updateIndexPaths(currentWorkDir, req.Path)
+	writeFsOK(w, map[string]string{"path": req.Path, "version": version.String(), "content": text, "encoding": encoding})
+}
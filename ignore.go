@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// globRule is one compiled gitignore-style pattern. Patterns without a slash
+// match a name at any depth; others are anchored to the directory they
+// belong to. "**" matches across directories.
+type globRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// compileGlob compiles a gitignore-style pattern. It returns false for
+// blank lines and comments.
+func compileGlob(pattern string) (globRule, bool) {
+	var rule globRule
+	pattern = strings.TrimRight(pattern, " \t\r")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return rule, false
+	}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\`) {
+		pattern = pattern[1:] // Escaped leading # or !
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return rule, false
+	}
+
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	if !anchored {
+		sb.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return rule, false
+	}
+	rule.re = re
+	return rule, true
+}
+
+// match reports whether the rule applies to rel, a slash-separated path
+// relative to the rule's base directory.
+func (g globRule) match(rel string, isDir bool) bool {
+	if g.dirOnly && !isDir {
+		return false
+	}
+	return g.re.MatchString(rel)
+}
+
+// compileGlobs compiles a list of patterns, such as include/exclude filters.
+func compileGlobs(patterns []string) []globRule {
+	var rules []globRule
+	for _, p := range patterns {
+		if rule, ok := compileGlob(strings.TrimSpace(p)); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// matchGlobs applies rules in order; the last matching rule decides, so a
+// negated pattern can re-include a path.
+func matchGlobs(rules []globRule, rel string, isDir bool) bool {
+	matched := false
+	for _, rule := range rules {
+		if rule.match(rel, isDir) {
+			matched = !rule.negate
+		}
+	}
+	return matched
+}
+
+// gitIgnore answers whether paths under root are ignored by the .gitignore
+// files in their directories and the repository's .git/info/exclude. Files
+// are loaded on first use, so one matcher should serve one walk.
+type gitIgnore struct {
+	root  string
+	mu    sync.Mutex
+	files map[string][]globRule
+}
+
+func newGitIgnore(root string) *gitIgnore {
+	return &gitIgnore{root: root, files: make(map[string][]globRule)}
+}
+
+func (g *gitIgnore) rules(dir string) []globRule {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if rules, ok := g.files[dir]; ok {
+		return rules
+	}
+	rules := readGlobFile(filepath.Join(dir, ".gitignore"))
+	if dir == g.root {
+		rules = append(readGlobFile(filepath.Join(dir, ".git", "info", "exclude")), rules...)
+	}
+	g.files[dir] = rules
+	return rules
+}
+
+// ignored reports whether path is ignored. Callers walking the tree skip
+// ignored directories, so only the path's own name needs checking against
+// each .gitignore from the root down.
+func (g *gitIgnore) ignored(path string, isDir bool) bool {
+	rel, err := filepath.Rel(g.root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	ignored := false
+	dir := g.root
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range parts {
+		sub := strings.Join(parts[i:], "/")
+		for _, rule := range g.rules(dir) {
+			if rule.match(sub, isDir) {
+				ignored = !rule.negate
+			}
+		}
+		dir = filepath.Join(dir, parts[i])
+	}
+	return ignored
+}
+
+func readGlobFile(path string) []globRule {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var rules []globRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := compileGlob(scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// defaultExcludeGlobs applies while the config has no exclude list of its own.
+var defaultExcludeGlobs = []string{"node_modules/"}
+
+// ignoreEngine is the one place deciding which workspace paths the file
+// tree, search and indexer leave out: hidden entries (unless shown), the
+// editor's own data, the configured exclude globs and .gitignore rules.
+type ignoreEngine struct {
+	root       string
+	exclude    []globRule
+	git        *gitIgnore
+	showHidden bool
+}
+
+// newIgnoreEngine returns an engine for one listing or walk of root; it
+// caches the .gitignore files it reads.
+func newIgnoreEngine(root string) *ignoreEngine {
+	globs := config.ExcludeGlobs
+	if globs == nil {
+		globs = defaultExcludeGlobs
+	}
+	return &ignoreEngine{
+		root:       root,
+		exclude:    compileGlobs(globs),
+		git:        newGitIgnore(root),
+		showHidden: config.ShowHidden,
+	}
+}
+
+func (e *ignoreEngine) ignored(path string, isDir bool) bool {
+	name := filepath.Base(path)
+	if name == ".git" || name == dataDirName {
+		return true
+	}
+	if !e.showHidden && strings.HasPrefix(name, ".") {
+		return true
+	}
+	if rel, err := filepath.Rel(e.root, path); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		if matchGlobs(e.exclude, filepath.ToSlash(rel), isDir) {
+			return true
+		}
+	}
+	return e.git.ignored(path, isDir)
+}
+
+// handleIgnoreSettings shows (GET) or changes (POST) the exclude globs and
+// the hidden files toggle. Changes re-index and re-watch the workspace.
+func handleIgnoreSettings(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if r.Method == "POST" {
+		var req struct {
+			ExcludeGlobs *[]string `json:"excludeGlobs"`
+			ShowHidden   *bool     `json:"showHidden"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.ExcludeGlobs != nil {
+			globs := *req.ExcludeGlobs
+			if globs == nil {
+				globs = []string{}
+			}
+			config.ExcludeGlobs = globs
+		}
+		if req.ShowHidden != nil {
+			config.ShowHidden = *req.ShowHidden
+		}
+		saveConfig()
+		invalidateFileList() // The rules decide which files it holds
+		if currentWorkDir != "" {
+			go updateIndex(currentWorkDir)
+			watchWorkspace(currentWorkDir)
+		}
+	}
+
+	globs := config.ExcludeGlobs
+	if globs == nil {
+		globs = defaultExcludeGlobs
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"excludeGlobs": globs,
+		"showHidden":   config.ShowHidden,
+	})
+}
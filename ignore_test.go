@@ -0,0 +1,86 @@
+package main
+
+import "testing"
+
+func TestCompileGlob(t *testing.T) {
+	for _, pattern := range []string{"", "   ", "# comment", "/", "!"} {
+		if _, ok := compileGlob(pattern); ok {
+			t.Errorf("compileGlob(%q) compiled, want it skipped", pattern)
+		}
+	}
+
+	tests := []struct {
+		pattern string
+		rel     string
+		isDir   bool
+		want    bool
+	}{
+		{"*.log", "a.log", false, true},
+		{"*.log", "x/y/a.log", false, true},
+		{"*.log", "a.logs", false, false},
+		{"/build", "build", true, true},
+		{"/build", "x/build", true, false},
+		{"docs/*.md", "docs/a.md", false, true},
+		{"docs/*.md", "docs/x/a.md", false, false},
+		{"docs/*.md", "x/docs/a.md", false, false},
+		{"node_modules/", "node_modules", true, true},
+		{"node_modules/", "node_modules", false, false},
+		{"node_modules/", "web/node_modules", true, true},
+		{"**/gen", "gen", true, true},
+		{"**/gen", "a/b/gen", false, true},
+		{"a/**/z", "a/z", false, true},
+		{"a/**/z", "a/b/c/z", false, true},
+		{"a/**", "a/b/c", false, true},
+		{"file?.go", "file1.go", false, true},
+		{"file?.go", "file12.go", false, false},
+		{"[ab].txt", "b.txt", false, true},
+		{"[!ab].txt", "b.txt", false, false},
+		{"[!ab].txt", "c.txt", false, true},
+		{"[ab", "[ab", false, true},
+		{`\#hash`, "#hash", false, true},
+		{`\!bang`, "!bang", false, true},
+		{`a\*b`, "a*b", false, true},
+		{`a\*b`, "axb", false, false},
+		{"trailing  ", "trailing", false, true},
+		{"a+b.(c)", "a+b.(c)", false, true},
+	}
+	for _, tt := range tests {
+		rule, ok := compileGlob(tt.pattern)
+		if !ok {
+			t.Errorf("compileGlob(%q) failed", tt.pattern)
+			continue
+		}
+		if got := rule.match(tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("%q matching %q (dir %v) = %v, want %v", tt.pattern, tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestMatchGlobs(t *testing.T) {
+	rules := compileGlobs([]string{"*.log", " !keep.log ", "", "# comment", "tmp/"})
+	if len(rules) != 3 {
+		t.Fatalf("compileGlobs kept %d rules, want 3", len(rules))
+	}
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"a.log", false, true},
+		{"keep.log", false, false}, // Re-included by the later negation
+		{"x/keep.log", false, false},
+		{"tmp", true, true},
+		{"tmp", false, false},
+		{"main.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := matchGlobs(rules, tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("matchGlobs(%q, dir %v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+
+	// The last matching rule decides
+	if !matchGlobs(compileGlobs([]string{"!a.log", "*.log"}), "a.log", false) {
+		t.Error("a negation before a matching rule should not re-include")
+	}
+}
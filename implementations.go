@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"go/token"
+	"go/types"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+type ImplementationResult struct {
+	Name      string `json:"name"` // Qualified, e.g. io.Reader or (*main.File).Read
+	Kind      string `json:"kind"` // Interface, Type or Method
+	Package   string `json:"package"`
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+	Character int    `json:"character"`
+	Pointer   bool   `json:"pointer"` // Only the pointer type satisfies the interface
+}
+
+type ImplementationsResponse struct {
+	Symbol string `json:"symbol"`
+	// "implementations" lists concrete types of an interface,
+	// "interfaces" lists interfaces satisfied by a concrete type.
+	Direction string                 `json:"direction"`
+	Results   []ImplementationResult `json:"results"`
+}
+
+// handleImplementations answers /api/implementations?path=&line=&character=
+// for the interface, type or method at that position.
+func handleImplementations(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	ws, obj, ok := resolveQueryObject(w, r)
+	if !ok {
+		return
+	}
+
+	var resp ImplementationsResponse
+	switch obj := obj.(type) {
+	case *types.TypeName:
+		resp.Symbol = types.ObjectString(obj, nil)
+		if iface, ok := obj.Type().Underlying().(*types.Interface); ok {
+			resp.Direction = "implementations"
+			for _, impl := range ws.implementationsOf(obj, iface) {
+				res := ws.objectResult(impl.Type, "Type")
+				res.Pointer = impl.Pointer
+				resp.Results = append(resp.Results, res)
+			}
+		} else {
+			resp.Direction = "interfaces"
+			resp.Results = ws.interfacesOf(obj.Type(), "")
+		}
+	case *types.Func:
+		resp.Symbol = obj.FullName()
+		sig := obj.Type().(*types.Signature)
+		if sig.Recv() == nil {
+			http.Error(w, "Not a type or method", http.StatusBadRequest)
+			return
+		}
+		recv := sig.Recv().Type()
+		if iface, ok := recv.Underlying().(*types.Interface); ok {
+			resp.Direction = "implementations"
+			named, _ := recv.(*types.Named)
+			if named == nil {
+				break
+			}
+			for _, impl := range ws.implementationsOf(named.Obj(), iface) {
+				if m := ws.methodResult(impl, obj.Name()); m != nil {
+					resp.Results = append(resp.Results, *m)
+				}
+			}
+		} else {
+			resp.Direction = "interfaces"
+			if ptr, ok := recv.(*types.Pointer); ok {
+				recv = ptr.Elem()
+			}
+			resp.Results = ws.interfacesOf(recv, obj.Name())
+		}
+	default:
+		http.Error(w, "Not a type or method", http.StatusBadRequest)
+		return
+	}
+
+	if resp.Results == nil {
+		resp.Results = []ImplementationResult{}
+	}
+	sortResults(resp.Results)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// resolveQueryObject loads the typed workspace and finds the object at the
+// path/line/character given in the query, writing an HTTP error if it can't.
+func resolveQueryObject(w http.ResponseWriter, r *http.Request) (*typedWorkspace, types.Object, bool) {
+	query := r.URL.Query()
+	path := query.Get("path")
+	line, errLine := strconv.Atoi(query.Get("line"))
+	col, errCol := strconv.Atoi(query.Get("character"))
+	if path == "" || errLine != nil || errCol != nil {
+		http.Error(w, "path, line and character required", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	ws, err := loadTypedWorkspace()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	obj, _ := ws.objectAt(path, line, col)
+	if obj == nil {
+		http.Error(w, "No symbol at position", http.StatusNotFound)
+		return nil, nil, false
+	}
+	return ws, obj, true
+}
+
+// implementer is a workspace type satisfying an interface.
+type implementer struct {
+	Type    *types.TypeName
+	Pointer bool // Only *Type satisfies the interface
+}
+
+// implementationsOf lists the workspace types that satisfy iface.
+func (ws *typedWorkspace) implementationsOf(ifaceObj *types.TypeName, iface *types.Interface) []implementer {
+	if iface.NumMethods() == 0 || !iface.IsMethodSet() {
+		return nil // Everything satisfies the empty interface; constraints aren't implemented
+	}
+	var results []implementer
+	for _, pkg := range ws.Packages {
+		if pkg.Types == nil {
+			continue
+		}
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn == ifaceObj || types.IsInterface(tn.Type()) || isGeneric(tn) {
+				continue
+			}
+			switch {
+			case types.Implements(tn.Type(), iface):
+				results = append(results, implementer{Type: tn})
+			case types.Implements(types.NewPointer(tn.Type()), iface):
+				results = append(results, implementer{Type: tn, Pointer: true})
+			}
+		}
+	}
+	return results
+}
+
+func isGeneric(tn *types.TypeName) bool {
+	named, ok := tn.Type().(*types.Named)
+	return ok && named.TypeParams().Len() > 0
+}
+
+// interfacesOf lists workspace and imported (including stdlib) interfaces
+// satisfied by typ or *typ. If method is set, only interfaces declaring that
+// method are returned, located at the interface method.
+func (ws *typedWorkspace) interfacesOf(typ types.Type, method string) []ImplementationResult {
+	var results []ImplementationResult
+	for _, pkg := range ws.allPackages() {
+		scope := pkg.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || isGeneric(tn) || !tn.Exported() && ws.Packages[pkg.Path()] == nil {
+				continue
+			}
+			iface, ok := tn.Type().Underlying().(*types.Interface)
+			if !ok || iface.NumMethods() == 0 || !iface.IsMethodSet() {
+				continue
+			}
+			var pointer bool
+			switch {
+			case types.Implements(typ, iface):
+			case types.Implements(types.NewPointer(typ), iface):
+				pointer = true
+			default:
+				continue
+			}
+
+			res := ws.objectResult(tn, "Interface")
+			if method != "" {
+				m, _, _ := types.LookupFieldOrMethod(tn.Type(), false, tn.Pkg(), method)
+				fn, ok := m.(*types.Func)
+				if !ok {
+					continue
+				}
+				res = ws.objectResult(fn, "Method")
+				res.Name = tn.Pkg().Name() + "." + tn.Name() + "." + method
+			}
+			res.Pointer = pointer
+			results = append(results, res)
+		}
+	}
+	return results
+}
+
+// methodResult locates the concrete method implementing name on impl's type.
+func (ws *typedWorkspace) methodResult(impl implementer, name string) *ImplementationResult {
+	obj, _, _ := types.LookupFieldOrMethod(impl.Type.Type(), true, impl.Type.Pkg(), name)
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return nil
+	}
+	res := ws.objectResult(fn, "Method")
+	res.Name = fn.FullName()
+	res.Pointer = impl.Pointer
+	return &res
+}
+
+func (ws *typedWorkspace) objectResult(obj types.Object, kind string) ImplementationResult {
+	res := ImplementationResult{
+		Name: obj.Name(),
+		Kind: kind,
+	}
+	if obj.Pkg() != nil {
+		res.Package = obj.Pkg().Path()
+		res.Name = obj.Pkg().Name() + "." + obj.Name()
+	}
+	if obj.Pos() != token.NoPos {
+		pos := ws.Fset.Position(obj.Pos())
+		res.Path = pos.Filename
+		res.Line = pos.Line
+		res.Character = pos.Column
+	}
+	return res
+}
+
+func sortResults(results []ImplementationResult) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Package != results[j].Package {
+			return results[i].Package < results[j].Package
+		}
+		return results[i].Name < results[j].Name
+	})
+}
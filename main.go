@@ -2,6 +2,7 @@ package main
 
 import (
 	"embed"
+	"fmt"
 	"io/fs"
 	"log"
 	"net/http"
@@ -46,9 +47,51 @@ func main() {
 	http.HandleFunc("/api/cmd", handleCmd)
 	http.HandleFunc("/api/env", handleEnv)
 	http.HandleFunc("/api/symbols", handleSymbols)
+	http.HandleFunc("/api/search", handleSearch)
+	http.HandleFunc("/api/search/cancel", handleSearchCancel)
+	http.HandleFunc("/api/replace", handleReplace)
+	http.HandleFunc("/api/symbols/search", handleSymbolSearch)
+	http.HandleFunc("/api/implementations", handleImplementations)
+	http.HandleFunc("/api/callhierarchy", handleCallHierarchy)
+	http.HandleFunc("/api/modules", handleModules)
+	http.HandleFunc("/api/gomod", handleGoMod)
+	http.HandleFunc("/api/gomod/edit", handleGoModEdit)
+	http.HandleFunc("/api/gomod/tidy", handleGoModTidy)
+	http.HandleFunc("/api/gomod/get", handleGoGet)
+	http.HandleFunc("/api/gomod/graph", handleGoModGraph)
+	http.HandleFunc("/api/gomod/why", handleGoModWhy)
+	http.HandleFunc("/api/buildtarget", handleBuildTarget)
 	http.HandleFunc("/api/fs/list", handleListFiles)
 	http.HandleFunc("/api/fs/read", handleReadFile)
+	http.HandleFunc("/api/fs/raw", handleRawFile)
+	http.HandleFunc("/api/fs/find", handleFindFiles)
+	http.HandleFunc("/api/fs/ignore", handleIgnoreSettings)
+	http.HandleFunc("/api/events", handleEvents)
+	http.HandleFunc("/api/git/status", handleGitStatus)
+	http.HandleFunc("/api/git/diff", handleGitDiff)
+	http.HandleFunc("/api/git/stage", handleGitStage)
+	http.HandleFunc("/api/git/unstage", handleGitUnstage)
+	http.HandleFunc("/api/git/stage-hunk", handleGitStageHunk)
+	http.HandleFunc("/api/git/commit", handleGitCommit)
+	http.HandleFunc("/api/git/blame", handleGitBlame)
+	http.HandleFunc("/api/git/log", handleGitLog)
+	http.HandleFunc("/api/git/show", handleGitShow)
+	http.HandleFunc("/api/git/gutter", handleGitGutter)
+	http.HandleFunc("/api/git/branches", handleGitBranches)
+	http.HandleFunc("/api/git/branch/create", handleGitCreateBranch)
+	http.HandleFunc("/api/git/branch/switch", handleGitSwitchBranch)
+	http.HandleFunc("/api/git/branch/delete", handleGitDeleteBranch)
+	http.HandleFunc("/api/git/stash", handleGitStash)
+	http.HandleFunc("/api/git/unstash", handleGitUnstash)
 	http.HandleFunc("/api/fs/save", handleSaveFile)
+	http.HandleFunc("/api/fs/create", handleCreateFile)
+	http.HandleFunc("/api/fs/mkdir", handleMkdir)
+	http.HandleFunc("/api/fs/rename", handleRename)
+	http.HandleFunc("/api/fs/copy", handleCopy)
+	http.HandleFunc("/api/fs/delete", handleDelete)
+	http.HandleFunc("/api/history/list", handleHistoryList)
+	http.HandleFunc("/api/history/diff", handleHistoryDiff)
+	http.HandleFunc("/api/history/restore", handleHistoryRestore)
 	http.HandleFunc("/api/fs/resolve", handleResolveFile)
 	http.HandleFunc("/api/fs/setworkdir", handleSetWorkDir)
 	http.HandleFunc("/api/fs/pickdir", handlePickDir)
@@ -63,12 +106,21 @@ func main() {
 	}
 	if currentWorkDir != "" {
 		go updateIndex(currentWorkDir)
+		watchWorkspace(currentWorkDir)
 	}
 
-	// Open browser automatically
-	openBrowser("http://localhost:" + port)
+	// Open browser automatically; the token in the URL authorizes it to use the API.
+	// The URL goes to the console and to tokenURLFile, never to the log file.
+	editorURL := "http://localhost:" + port + "/?token=" + apiToken
+	fmt.Printf("Editor URL: %s\n", editorURL)
+	if err := writeTokenURL(editorURL); err != nil {
+		log.Printf("Failed to write %s: %v\n", tokenURLFile, err)
+	} else {
+		log.Printf("Issued API token for this session; the editor URL is in %s\n", tokenURLFile)
+	}
+	openBrowser(editorURL)
 
-	err = http.ListenAndServe(":" + port, nil)
+	err = http.ListenAndServe(":"+port, requireAPIAuth(port, http.DefaultServeMux))
 	if err != nil {
 		log.Fatal(err)
 	}
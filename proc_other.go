@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+import "os/exec"
+
+// hideWindow does nothing where commands don't get a console window.
+func hideWindow(cmd *exec.Cmd) {}
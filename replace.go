@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const maxReplaceFiles = 1000
+
+// ReplaceRequest previews or applies a workspace-wide replacement. Without
+// Apply, every matching file is returned with a diff. With Apply, only Files
+// are changed; each may name the version its preview was based on and the
+// lines to change (all matching lines if empty).
+type ReplaceRequest struct {
+	Query         string        `json:"query"`
+	Replacement   string        `json:"replacement"` // $1 / ${name} refer to groups in regex mode
+	Regex         bool          `json:"regex"`
+	CaseSensitive bool          `json:"caseSensitive"`
+	WholeWord     bool          `json:"wholeWord"`
+	Include       []string      `json:"include"`
+	Exclude       []string      `json:"exclude"`
+	Apply         bool          `json:"apply"`
+	Files         []ReplaceFile `json:"files"`
+}
+
+type ReplaceFile struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Lines   []int  `json:"lines"`
+}
+
+// ReplacePreview is the outcome for one file.
+type ReplacePreview struct {
+	Path         string     `json:"path"`
+	Version      string     `json:"version"`
+	Encoding     string     `json:"encoding"`
+	Replacements int        `json:"replacements"`
+	Hunks        []DiffHunk `json:"hunks,omitempty"`
+	Diff         string     `json:"diff,omitempty"`
+}
+
+// fileEdit is a computed replacement not yet written.
+type fileEdit struct {
+	path         string
+	version      fileVersion
+	encoding     string
+	oldData      []byte // As read, for rolling back
+	oldText      string
+	newText      string
+	replacements int
+}
+
+// replaceInText applies re to each line of text (so ^ and $ work per line),
+// limited to the given 1-based lines if any. It returns the new text and the
+// number of replacements. Empty matches are never replaced: a pattern like
+// "x*" would otherwise put the replacement between every pair of characters.
+func replaceInText(text string, re *regexp.Regexp, replacement string, literal bool, only []int) (string, int) {
+	selected := make(map[int]bool, len(only))
+	for _, n := range only {
+		selected[n] = true
+	}
+
+	lines := strings.Split(text, "\n")
+	count := 0
+	for i, line := range lines {
+		if len(selected) > 0 && !selected[i+1] {
+			continue
+		}
+		body, cr := strings.CutSuffix(line, "\r")
+		var out []byte
+		last, n := 0, 0
+		for _, m := range re.FindAllStringSubmatchIndex(body, -1) {
+			if m[0] == m[1] {
+				continue
+			}
+			out = append(out, body[last:m[0]]...)
+			if literal {
+				out = append(out, replacement...)
+			} else {
+				out = re.ExpandString(out, replacement, body, m)
+			}
+			last = m[1]
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		out = append(out, body[last:]...)
+		if cr {
+			out = append(out, '\r')
+		}
+		lines[i] = string(out)
+		count += n
+	}
+	return strings.Join(lines, "\n"), count
+}
+
+var errReplaceTooLarge = fmt.Errorf("larger than the %d MB replace limit", maxSearchFileSize>>20)
+
+// computeEdit reads path and computes its replacement. It returns nil if
+// nothing would change, and errReplaceTooLarge for files search skips too.
+func computeEdit(path string, re *regexp.Regexp, req *ReplaceRequest, only []int) (*fileEdit, error) {
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.Size() > maxSearchFileSize {
+		return nil, errReplaceTooLarge
+	}
+	data, version, err := readVersioned(path)
+	if err != nil {
+		return nil, err
+	}
+	if isBinary(data[:min(len(data), sniffSize)]) {
+		return nil, nil
+	}
+	oldText, encoding := decodeFile(data)
+	newText, n := replaceInText(oldText, re, req.Replacement, !req.Regex, only)
+	if n == 0 || newText == oldText {
+		return nil, nil
+	}
+	return &fileEdit{path: path, version: version, encoding: encoding, oldData: data, oldText: oldText, newText: newText, replacements: n}, nil
+}
+
+func (e *fileEdit) preview() ReplacePreview {
+	hunks := diffHunks(diffLines(splitLines(e.oldText), splitLines(e.newText)), historyDiffContext)
+	name := filepath.ToSlash(mustRel(currentWorkDir, e.path))
+	return ReplacePreview{
+		Path:         e.path,
+		Version:      e.version.String(),
+		Encoding:     e.encoding,
+		Replacements: e.replacements,
+		Hunks:        hunks,
+		Diff:         unifiedDiff("a/"+name, "b/"+name, hunks),
+	}
+}
+
+// handleReplace previews a replacement across the workspace, or applies it
+// to the selected files. Applying checks every file against its previewed
+// version before writing any and rolls back on a failed write; the watcher
+// re-indexes the written files once, as one debounced batch. Files over the
+// search size limit are listed as skipped in a preview and refused in apply.
+func handleReplace(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	var req ReplaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if currentWorkDir == "" {
+		http.Error(w, "No workspace directory set", http.StatusBadRequest)
+		return
+	}
+	if req.Query == "" {
+		http.Error(w, "query required", http.StatusBadRequest)
+		return
+	}
+	re, err := compileSearch(SearchOptions{Query: req.Query, Regex: req.Regex, CaseSensitive: req.CaseSensitive, WholeWord: req.WholeWord})
+	if err != nil {
+		http.Error(w, "Invalid pattern: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Apply {
+		applyReplace(w, r, re, &req)
+		return
+	}
+
+	previews := []ReplacePreview{}
+	skipped := []string{}
+	total := 0
+	err = walkSearchFiles(r.Context(), currentWorkDir, compileGlobs(req.Include), compileGlobs(req.Exclude), func(path, rel string) error {
+		edit, err := computeEdit(path, re, &req, nil)
+		if errors.Is(err, errReplaceTooLarge) {
+			skipped = append(skipped, path)
+			return nil
+		}
+		if err != nil || edit == nil {
+			return nil
+		}
+		previews = append(previews, edit.preview())
+		total += edit.replacements
+		if len(previews) >= maxReplaceFiles {
+			return errSearchLimit
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errSearchLimit) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"files":        previews,
+		"replacements": total,
+		"skipped":      skipped, // Too large to replace in
+		"limitHit":     errors.Is(err, errSearchLimit),
+	})
+}
+
+func applyReplace(w http.ResponseWriter, r *http.Request, re *regexp.Regexp, req *ReplaceRequest) {
+	if len(req.Files) == 0 {
+		http.Error(w, "files required", http.StatusBadRequest)
+		return
+	}
+
+	// Compute and check everything before touching the disk
+	var edits []*fileEdit
+	for _, f := range req.Files {
+		path, ok := checkWorkspacePath(w, r, f.Path)
+		if !ok {
+			return
+		}
+		edit, err := computeEdit(path, re, req, f.Lines)
+		if errors.Is(err, errReplaceTooLarge) {
+			http.Error(w, path+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if edit == nil {
+			continue
+		}
+		if f.Version != "" {
+			expected, err := parseFileVersion(f.Version)
+			if err != nil {
+				writeSaveError(w, err)
+				return
+			}
+			if expected.Hash != edit.version.Hash {
+				data, current, _ := readVersioned(path)
+				writeSaveError(w, &conflictError{Path: path, Current: current, Content: data})
+				return
+			}
+		}
+		edits = append(edits, edit)
+	}
+
+	var written []*fileEdit
+	results := []ReplacePreview{}
+	for _, edit := range edits {
+		version, err := saveWorkspaceFile(edit.path, edit.newText, edit.encoding, edit.version.String())
+		if err != nil {
+			rollbackReplace(written)
+			writeSaveError(w, fmt.Errorf("%s: %w", edit.path, err))
+			return
+		}
+		written = append(written, edit)
+		results = append(results, ReplacePreview{Path: edit.path, Version: version.String(), Encoding: edit.encoding, Replacements: edit.replacements})
+	}
+
+	// The watcher sees the writes and re-indexes them in one batch
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "files": results})
+}
+
+// rollbackReplace restores the exact bytes of files already written by a
+// replace that failed part way through.
+func rollbackReplace(written []*fileEdit) {
+	for _, edit := range written {
+		if _, err := writeWorkspaceBytes(edit.path, edit.oldData, ""); err != nil {
+			log.Printf("Failed to roll back replace in %s: %v\n", edit.path, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestReplaceInText(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		pattern     string
+		replacement string
+		literal     bool
+		only        []int
+		want        string
+		count       int
+	}{
+		{"literal", "foo bar foo\nfoo", `foo`, "x", true, nil, "x bar x\nx", 3},
+		{"literal keeps $", "a b", `a`, "$1", true, nil, "$1 b", 1},
+		{"groups", "key=value\nk=v", `(\w+)=(\w+)`, "$2=$1", false, nil, "value=key\nv=k", 2},
+		{"named groups", "ab", `(?P<x>a)(?P<y>b)`, "${y}${x}", false, nil, "ba", 1},
+		{"selected lines", "a\na\na", `a`, "b", true, []int{2}, "a\nb\na", 1},
+		{"per-line anchors", "ab\nab", `^a`, "x", false, nil, "xb\nxb", 2},
+		{"CRLF kept", "a\r\nb\r\n", `a`, "c", true, nil, "c\r\nb\r\n", 1},
+		{"end anchor before CR", "ab\r\n", `b$`, "c", false, nil, "ac\r\n", 1},
+		{"no match", "abc", `x`, "y", true, nil, "abc", 0},
+		// Empty matches on a line with a real match are left alone
+		{"empty matches skipped", "axxb", `x*`, "-", false, nil, "a-b", 1},
+		{"only empty matches", "abc", `x*`, "-", false, nil, "abc", 0},
+	}
+	for _, tt := range tests {
+		re := regexp.MustCompile(tt.pattern)
+		got, n := replaceInText(tt.text, re, tt.replacement, tt.literal, tt.only)
+		if got != tt.want || n != tt.count {
+			t.Errorf("%s: replaceInText = %q, %d, want %q, %d", tt.name, got, n, tt.want, tt.count)
+		}
+	}
+}
+
+func TestComputeEditTooLarge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "big.txt")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(maxSearchFileSize + 1); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	req := &ReplaceRequest{Query: "a", Replacement: "b"}
+	if _, err := computeEdit(path, regexp.MustCompile("a"), req, nil); !errors.Is(err, errReplaceTooLarge) {
+		t.Errorf("computeEdit on a large file: err = %v, want errReplaceTooLarge", err)
+	}
+
+	small := filepath.Join(dir, "small.txt")
+	if err := os.WriteFile(small, []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	edit, err := computeEdit(small, regexp.MustCompile("a"), req, nil)
+	if err != nil || edit == nil || edit.newText != "b\n" || string(edit.oldData) != "a\n" {
+		t.Errorf("computeEdit = %+v, %v", edit, err)
+	}
+}
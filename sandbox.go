@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// outsideWorkspaceError is returned for paths that resolve, after following
+// symlinks, outside every workspace root.
+type outsideWorkspaceError struct {
+	Path string
+}
+
+func (e *outsideWorkspaceError) Error() string {
+	return "path is outside the workspace: " + e.Path
+}
+
+// workspaceRoots is the allow-list of directories the fs endpoints may touch:
+// the current workspace, modules a go.work file pulls in from elsewhere and
+// any extra roots from the config.
+func workspaceRoots() []string {
+	var roots []string
+	if currentWorkDir != "" {
+		roots = append(roots, currentWorkDir)
+	}
+	if layout := snapshotLayout(); layout != nil && layout.Root == currentWorkDir {
+		for _, mod := range layout.Modules {
+			if mod.Source == sourceGoWork {
+				roots = append(roots, mod.Dir)
+			}
+		}
+	}
+	return append(roots, config.AllowedRoots...)
+}
+
+// resolveWorkspacePath makes p absolute and checks that its real location lies
+// inside a workspace root. The path need not exist yet.
+func resolveWorkspacePath(p string) (string, error) {
+	if p == "" {
+		return "", errors.New("path required")
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	real := realPath(abs)
+	for _, root := range workspaceRoots() {
+		if pathWithin(realPath(root), real) {
+			return abs, nil
+		}
+	}
+	return "", &outsideWorkspaceError{Path: p}
+}
+
+// realPath resolves symlinks in the longest existing prefix of p, so that
+// files about to be created are checked against where they will really land.
+func realPath(p string) string {
+	p = filepath.Clean(p)
+	var rest []string
+	for {
+		if resolved, err := filepath.EvalSymlinks(p); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...)
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return filepath.Join(append([]string{p}, rest...)...)
+		}
+		rest = append([]string{filepath.Base(p)}, rest...)
+		p = parent
+	}
+}
+
+// pathWithin reports whether p is root or below it.
+func pathWithin(root, p string) bool {
+	if runtime.GOOS == "windows" {
+		root, p = strings.ToLower(root), strings.ToLower(p)
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// checkWorkspacePath resolves p with resolveWorkspacePath, writing a 403
+// (outside the workspace) or 400 response if it is rejected.
+func checkWorkspacePath(w http.ResponseWriter, r *http.Request, p string) (string, bool) {
+	resolved, err := resolveWorkspacePath(p)
+	if err == nil {
+		return resolved, true
+	}
+
+	writePathError(w, r, p, err)
+	return "", false
+}
+
+// resolveWorkDir makes p absolute for use as the workspace. If the config
+// lists allowed roots, its real location must lie inside one of them;
+// otherwise any directory may be opened.
+func resolveWorkDir(p string) (string, error) {
+	if p == "" {
+		return "", errors.New("path required")
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	if len(config.AllowedRoots) == 0 {
+		return abs, nil
+	}
+	real := realPath(abs)
+	for _, root := range config.AllowedRoots {
+		if pathWithin(realPath(root), real) {
+			return abs, nil
+		}
+	}
+	return "", &outsideWorkspaceError{Path: p}
+}
+
+// checkWorkDir is checkWorkspacePath for a new workspace root.
+func checkWorkDir(w http.ResponseWriter, r *http.Request, p string) (string, bool) {
+	resolved, err := resolveWorkDir(p)
+	if err == nil {
+		return resolved, true
+	}
+	writePathError(w, r, p, err)
+	return "", false
+}
+
+// writePathError writes a 403 (outside the workspace) or 400 response for a
+// rejected path.
+func writePathError(w http.ResponseWriter, r *http.Request, p string, err error) {
+	var outside *outsideWorkspaceError
+	if errors.As(err, &outside) {
+		log.Printf("Rejected %s %s: %v\n", r.Method, r.URL.Path, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+			"type":  "outside_workspace",
+			"path":  p,
+		})
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// isWorkspaceFile reports whether p is an existing regular file inside the
+// workspace; used to filter paths the server discovers on its own.
+func isWorkspaceFile(p string) bool {
+	if _, err := resolveWorkspacePath(p); err != nil {
+		return false
+	}
+	info, err := os.Stat(p)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupSandbox makes a workspace with a file and a directory outside it,
+// plus symlinks from the workspace to both.
+func setupSandbox(t *testing.T) (ws, outside string) {
+	base := t.TempDir()
+	ws = filepath.Join(base, "ws")
+	outside = filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(ws, "sub"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(ws, "escape")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	if err := os.Symlink(filepath.Join(ws, "sub"), filepath.Join(ws, "inner")); err != nil {
+		t.Fatal(err)
+	}
+
+	savedDir, savedRoots := currentWorkDir, config.AllowedRoots
+	currentWorkDir, config.AllowedRoots = ws, nil
+	t.Cleanup(func() { currentWorkDir, config.AllowedRoots = savedDir, savedRoots })
+	return ws, outside
+}
+
+func TestResolveWorkspacePath(t *testing.T) {
+	ws, outside := setupSandbox(t)
+
+	tests := []struct {
+		name string
+		path string
+		ok   bool
+	}{
+		{"root", ws, true},
+		{"file", filepath.Join(ws, "main.go"), true},
+		{"new file in new dir", filepath.Join(ws, "a", "b", "new.go"), true},
+		{"dot dot inside", filepath.Join(ws, "sub", "..", "main.go"), true},
+		{"dot dot out", ws + string(filepath.Separator) + filepath.Join("..", "outside", "secret.txt"), false},
+		{"outside", filepath.Join(outside, "secret.txt"), false},
+		{"sibling with common prefix", ws + "2", false},
+		{"symlink inside", filepath.Join(ws, "inner", "x.go"), true},
+		{"symlink escape", filepath.Join(ws, "escape", "secret.txt"), false},
+		{"new file through symlink escape", filepath.Join(ws, "escape", "new", "x.go"), false},
+		{"symlink escape then dot dot", filepath.Join(ws, "escape") + string(filepath.Separator) + filepath.Join("..", "ws", "main.go"), true},
+	}
+	for _, tt := range tests {
+		got, err := resolveWorkspacePath(tt.path)
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.ok {
+			var outsideErr *outsideWorkspaceError
+			if !errors.As(err, &outsideErr) {
+				t.Errorf("%s: resolved to %q (err %v), want outside_workspace", tt.name, got, err)
+			}
+		}
+	}
+
+	if _, err := resolveWorkspacePath(""); err == nil {
+		t.Error("empty path accepted")
+	}
+
+	config.AllowedRoots = []string{outside}
+	if _, err := resolveWorkspacePath(filepath.Join(ws, "escape", "secret.txt")); err != nil {
+		t.Errorf("symlink into an allowed root: %v", err)
+	}
+}
+
+func TestCheckWorkspacePath(t *testing.T) {
+	ws, outside := setupSandbox(t)
+
+	tests := []struct {
+		path string
+		want int
+		typ  string
+	}{
+		{filepath.Join(ws, "main.go"), 0, ""},
+		{filepath.Join(ws, "escape", "secret.txt"), http.StatusForbidden, "outside_workspace"},
+		{filepath.Join(outside, "secret.txt"), http.StatusForbidden, "outside_workspace"},
+		{"", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/fs/read", nil)
+		_, ok := checkWorkspacePath(w, r, tt.path)
+		if ok != (tt.want == 0) {
+			t.Errorf("%q: ok = %v", tt.path, ok)
+			continue
+		}
+		if ok {
+			continue
+		}
+		if w.Code != tt.want {
+			t.Errorf("%q: status %d, want %d", tt.path, w.Code, tt.want)
+		}
+		var body struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if body.Type != tt.typ {
+			t.Errorf("%q: type %q, want %q", tt.path, body.Type, tt.typ)
+		}
+	}
+}
+
+func TestResolveWorkDir(t *testing.T) {
+	ws, outside := setupSandbox(t)
+
+	// Without allowed roots any directory can become the workspace
+	if _, err := resolveWorkDir(outside); err != nil {
+		t.Errorf("no allowed roots: %v", err)
+	}
+
+	config.AllowedRoots = []string{ws}
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{ws, true},
+		{filepath.Join(ws, "sub"), true},
+		{filepath.Join(ws, "inner"), true},
+		{outside, false},
+		{filepath.Join(ws, "escape"), false},
+		{filepath.Join(ws, "sub", "..", ".."), false},
+	}
+	for _, tt := range tests {
+		_, err := resolveWorkDir(tt.path)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: err = %v, want ok %v", tt.path, err, tt.ok)
+		}
+	}
+}
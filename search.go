@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	defaultSearchResults = 10000
+	maxSearchContext     = 10
+	maxSearchFileSize    = 10 << 20
+	maxSearchLineLength  = 1000 // Longer lines are cut in results
+)
+
+// SearchOptions are the parameters of a full-text search.
+type SearchOptions struct {
+	Query         string
+	Regex         bool
+	CaseSensitive bool
+	WholeWord     bool
+	Include       []string
+	Exclude       []string
+	Context       int
+	MaxResults    int
+}
+
+// SearchMatch is one match. Line and Column are 1-based; Column and Length
+// count UTF-16 code units, as the editor does.
+type SearchMatch struct {
+	Line   int      `json:"line"`
+	Column int      `json:"column"`
+	Length int      `json:"length"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// SearchFileResult holds the matches in one file. The search streams one
+// per line of NDJSON as files are searched, followed by a SearchSummary.
+type SearchFileResult struct {
+	Type     string        `json:"type"` // "file"
+	Path     string        `json:"path"`
+	Encoding string        `json:"encoding"`
+	Matches  []SearchMatch `json:"matches"`
+}
+
+type SearchSummary struct {
+	Type      string `json:"type"` // "done"
+	Files     int    `json:"files"`
+	Matches   int    `json:"matches"`
+	LimitHit  bool   `json:"limitHit"`
+	Cancelled bool   `json:"cancelled"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Running searches by client-chosen id, so /api/search/cancel can stop one
+// the client can't abort itself.
+type runningSearch struct {
+	cancel context.CancelFunc
+}
+
+var (
+	searches     = make(map[string]*runningSearch)
+	searchesLock sync.Mutex
+)
+
+var errSearchLimit = errors.New("result limit reached")
+
+// compileSearch turns the query and options into a regexp.
+func compileSearch(opts SearchOptions) (*regexp.Regexp, error) {
+	pattern := opts.Query
+	if !opts.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if opts.WholeWord {
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	if !opts.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// walkSearchFiles calls fn for each file under root the search should look
+// at: not left out by the workspace ignore rules and passing the
+// include/exclude globs.
+func walkSearchFiles(ctx context.Context, root string, include, exclude []globRule, fn func(path, rel string) error) error {
+	ignore := newIgnoreEngine(root)
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Unreadable entries are skipped
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if path == root {
+			return nil
+		}
+		rel := filepath.ToSlash(mustRel(root, path))
+		if d.IsDir() {
+			if ignore.ignored(path, true) || matchGlobs(exclude, rel, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || ignore.ignored(path, false) || matchGlobs(exclude, rel, false) {
+			return nil
+		}
+		if len(include) > 0 && !matchGlobs(include, rel, false) {
+			return nil
+		}
+		return fn(path, rel)
+	})
+}
+
+func mustRel(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// searchFile returns the matches of re in a text file. Binary and very large
+// files are skipped.
+func searchFile(path string, re *regexp.Regexp, context, limit int) *SearchFileResult {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > maxSearchFileSize {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || isBinary(data[:min(len(data), sniffSize)]) {
+		return nil
+	}
+	text, encoding := decodeFile(data)
+	lines := splitLines(text)
+
+	var matches []SearchMatch
+	for i, line := range lines {
+		for _, loc := range re.FindAllStringIndex(line, -1) {
+			if loc[0] == loc[1] {
+				continue // Empty matches (e.g. "^") aren't useful results
+			}
+			m := SearchMatch{
+				Line:   i + 1,
+				Column: utf16Len(line[:loc[0]]) + 1,
+				Length: utf16Len(line[loc[0]:loc[1]]),
+				Text:   truncateLine(line),
+			}
+			if context > 0 {
+				m.Before = contextLines(lines, i-context, i)
+				m.After = contextLines(lines, i+1, i+1+context)
+			}
+			matches = append(matches, m)
+			if len(matches) >= limit {
+				break
+			}
+		}
+		if len(matches) >= limit {
+			break
+		}
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+	return &SearchFileResult{Type: "file", Path: path, Encoding: encoding, Matches: matches}
+}
+
+func contextLines(lines []string, from, to int) []string {
+	from, to = max(from, 0), min(to, len(lines))
+	var out []string
+	for _, l := range lines[from:to] {
+		out = append(out, truncateLine(l))
+	}
+	return out
+}
+
+func truncateLine(line string) string {
+	if len(line) <= maxSearchLineLength {
+		return line
+	}
+	cut := maxSearchLineLength
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut] + "…"
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// splitList splits a comma-separated query parameter.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func parseSearchOptions(r *http.Request) SearchOptions {
+	q := r.URL.Query()
+	opts := SearchOptions{
+		Query:         q.Get("q"),
+		Regex:         q.Get("regex") == "true",
+		CaseSensitive: q.Get("case") == "true",
+		WholeWord:     q.Get("word") == "true",
+		Include:       splitList(q.Get("include")),
+		Exclude:       splitList(q.Get("exclude")),
+		Context:       2,
+		MaxResults:    defaultSearchResults,
+	}
+	if n, err := strconv.Atoi(q.Get("context")); err == nil && n >= 0 {
+		opts.Context = min(n, maxSearchContext)
+	}
+	if n, err := strconv.Atoi(q.Get("limit")); err == nil && n > 0 {
+		opts.MaxResults = min(n, defaultSearchResults)
+	}
+	return opts
+}
+
+// handleSearch searches the workspace and streams results as NDJSON. The
+// search stops when the client disconnects or /api/search/cancel is called
+// with the same id.
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if currentWorkDir == "" {
+		http.Error(w, "No workspace directory set", http.StatusBadRequest)
+		return
+	}
+	opts := parseSearchOptions(r)
+	if opts.Query == "" {
+		http.Error(w, "q required", http.StatusBadRequest)
+		return
+	}
+	re, err := compileSearch(opts)
+	if err != nil {
+		http.Error(w, "Invalid pattern: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	if id := r.URL.Query().Get("id"); id != "" {
+		running := &runningSearch{cancel: cancel}
+		searchesLock.Lock()
+		if prev, ok := searches[id]; ok {
+			prev.cancel() // A new search with the same id replaces the old one
+		}
+		searches[id] = running
+		searchesLock.Unlock()
+		defer func() {
+			searchesLock.Lock()
+			if searches[id] == running {
+				delete(searches, id)
+			}
+			searchesLock.Unlock()
+		}()
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+
+	summary := SearchSummary{Type: "done"}
+	err = walkSearchFiles(ctx, currentWorkDir, compileGlobs(opts.Include), compileGlobs(opts.Exclude), func(path, rel string) error {
+		result := searchFile(path, re, opts.Context, opts.MaxResults-summary.Matches)
+		if result == nil {
+			return nil
+		}
+		summary.Files++
+		summary.Matches += len(result.Matches)
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if summary.Matches >= opts.MaxResults {
+			return errSearchLimit
+		}
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, errSearchLimit):
+		summary.LimitHit = true
+	case ctx.Err() != nil:
+		summary.Cancelled = true
+	case err != nil:
+		summary.Error = err.Error()
+	}
+	enc.Encode(summary)
+}
+
+// handleSearchCancel stops a running search by id.
+func handleSearchCancel(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	searchesLock.Lock()
+	running, ok := searches[id]
+	searchesLock.Unlock()
+	if ok {
+		running.cancel()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"cancelled": ok})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompileSearch(t *testing.T) {
+	tests := []struct {
+		opts  SearchOptions
+		text  string
+		match bool
+	}{
+		{SearchOptions{Query: "a.b"}, "a.b", true},
+		{SearchOptions{Query: "a.b"}, "axb", false},
+		{SearchOptions{Query: "a.b", Regex: true}, "axb", true},
+		{SearchOptions{Query: "Foo"}, "foo", true},
+		{SearchOptions{Query: "Foo", CaseSensitive: true}, "foo", false},
+		{SearchOptions{Query: "foo", WholeWord: true}, "foo()", true},
+		{SearchOptions{Query: "foo", WholeWord: true}, "foobar", false},
+		{SearchOptions{Query: "a|b", Regex: true, WholeWord: true}, "xa", false},
+	}
+	for _, tt := range tests {
+		re, err := compileSearch(tt.opts)
+		if err != nil {
+			t.Errorf("%+v: %v", tt.opts, err)
+			continue
+		}
+		if got := re.MatchString(tt.text); got != tt.match {
+			t.Errorf("%+v on %q: match %v, want %v", tt.opts, tt.text, got, tt.match)
+		}
+	}
+	if _, err := compileSearch(SearchOptions{Query: "(", Regex: true}); err == nil {
+		t.Error("invalid regexp accepted")
+	}
+}
+
+func TestSearchFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.go")
+	text := "package a\r\n\r\n// 中文 foo\r\nvar foo, 𝒳foo = 1, 2\r\n"
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	re, _ := compileSearch(SearchOptions{Query: "foo"})
+
+	res := searchFile(path, re, 1, 100)
+	if res == nil {
+		t.Fatal("no result")
+	}
+	want := []SearchMatch{
+		{Line: 3, Column: 7, Length: 3, Text: "// 中文 foo", Before: []string{""}, After: []string{"var foo, 𝒳foo = 1, 2"}},
+		{Line: 4, Column: 5, Length: 3, Text: "var foo, 𝒳foo = 1, 2", Before: []string{"// 中文 foo"}},
+		{Line: 4, Column: 12, Length: 3, Text: "var foo, 𝒳foo = 1, 2", Before: []string{"// 中文 foo"}}, // 𝒳 is two UTF-16 units
+	}
+	if !reflect.DeepEqual(res.Matches, want) {
+		t.Errorf("matches:\n got %+v\nwant %+v", res.Matches, want)
+	}
+
+	if res := searchFile(path, re, 0, 2); res == nil || len(res.Matches) != 2 {
+		t.Errorf("limit not applied: %+v", res)
+	}
+
+	// Empty matches are not results
+	empty, _ := compileSearch(SearchOptions{Query: "^", Regex: true})
+	if res := searchFile(path, empty, 0, 100); res != nil {
+		t.Errorf("empty matches reported: %+v", res.Matches)
+	}
+
+	bin := filepath.Join(dir, "bin")
+	if err := os.WriteFile(bin, []byte("foo\x00foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if res := searchFile(bin, re, 0, 100); res != nil {
+		t.Error("binary file searched")
+	}
+}
+
+func TestTruncateLine(t *testing.T) {
+	long := strings.Repeat("a", maxSearchLineLength-1) + "中"
+	got := truncateLine(long)
+	if got != strings.Repeat("a", maxSearchLineLength-1)+"…" {
+		t.Errorf("cut inside a character: %q", got[len(got)-8:])
+	}
+	if truncateLine("short") != "short" {
+		t.Error("short line changed")
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Match tiers, best first. A symbol is scored by the best tier it reaches.
+const (
+	scoreExact     = 1000
+	scorePrefix    = 800
+	scoreCamel     = 600
+	scoreSubstring = 400
+	scoreFuzzy     = 200
+)
+
+const (
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+)
+
+// indexEpoch makes ETags unique per launch, since symbolVersion restarts at zero.
+var indexEpoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+type SymbolMatch struct {
+	Symbol
+	Score int    `json:"score"`
+	Match string `json:"match"` // exact, prefix, camel, substring, fuzzy
+}
+
+type SymbolSearchResponse struct {
+	Version uint64        `json:"version"`
+	Total   int           `json:"total"` // Matches before the limit was applied
+	Results []SymbolMatch `json:"results"`
+}
+
+func snapshotSymbols() ([]Symbol, uint64) {
+	cacheMutex.RLock()
+	defer cacheMutex.RUnlock()
+	return symbolCache, symbolVersion
+}
+
+// checkNotModified sets the index ETag and answers 304 if the client already
+// has the current version.
+func checkNotModified(w http.ResponseWriter, r *http.Request, version uint64) bool {
+	etag := fmt.Sprintf(`"idx-%s-%d"`, indexEpoch, version)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag")
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if strings.TrimSpace(candidate) == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+func handleSymbolSearch(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	symbols, version := snapshotSymbols()
+	if checkNotModified(w, r, version) {
+		return
+	}
+
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+
+	limit := defaultSearchLimit
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+
+	// kind=Function,Method (case-insensitive)
+	kinds := map[string]bool{}
+	for _, k := range strings.Split(query.Get("kind"), ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			kinds[strings.ToLower(k)] = true
+		}
+	}
+
+	// excluded=false hides symbols that only exist for other build targets
+	hideExcluded := query.Get("excluded") == "false"
+
+	var results []SymbolMatch
+	for _, s := range symbols {
+		if len(kinds) > 0 && !kinds[strings.ToLower(s.Kind)] {
+			continue
+		}
+		if hideExcluded && s.Excluded {
+			continue
+		}
+		score, match := scoreSymbol(s.Name, q)
+		if score == 0 {
+			continue
+		}
+		results = append(results, SymbolMatch{Symbol: s, Score: score, Match: match})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Excluded != b.Excluded {
+			return !a.Excluded
+		}
+		if len(a.Name) != len(b.Name) {
+			return len(a.Name) < len(b.Name)
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Path < b.Path
+	})
+
+	resp := SymbolSearchResponse{Version: version, Total: len(results), Results: results}
+	if len(resp.Results) > limit {
+		resp.Results = resp.Results[:limit]
+	}
+	if resp.Results == nil {
+		resp.Results = []SymbolMatch{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// scoreSymbol ranks name against query. A zero score means no match.
+// An empty query matches everything with the lowest possible score.
+func scoreSymbol(name, q string) (int, string) {
+	if q == "" {
+		return 1, ""
+	}
+	lowerName, lowerQ := strings.ToLower(name), strings.ToLower(q)
+
+	switch {
+	case name == q:
+		return scoreExact + 50, "exact"
+	case lowerName == lowerQ:
+		return scoreExact, "exact"
+	case strings.HasPrefix(name, q):
+		return scorePrefix + 50, "prefix"
+	case strings.HasPrefix(lowerName, lowerQ):
+		return scorePrefix, "prefix"
+	}
+
+	if skipped := camelMatch(splitCamel(name), []rune(lowerQ)); skipped >= 0 {
+		return scoreCamel - skipped, "camel"
+	}
+	if idx := strings.Index(lowerName, lowerQ); idx >= 0 {
+		return scoreSubstring - idx, "substring"
+	}
+	if spread := fuzzyMatch([]rune(lowerName), []rune(lowerQ)); spread >= 0 {
+		return max(scoreFuzzy-spread, 2), "fuzzy"
+	}
+	return 0, ""
+}
+
+// splitCamel breaks an identifier into lower-cased words:
+// "handleSaveFile" -> handle, save, file; "HTTPServer" -> http, server.
+func splitCamel(name string) [][]rune {
+	var words [][]rune
+	var cur []rune
+	runes := []rune(name)
+	for i, c := range runes {
+		if c == '_' {
+			if len(cur) > 0 {
+				words = append(words, cur)
+				cur = nil
+			}
+			continue
+		}
+		boundary := false
+		if i > 0 && len(cur) > 0 {
+			prev := runes[i-1]
+			switch {
+			case unicode.IsUpper(c) && !unicode.IsUpper(prev):
+				boundary = true
+			case unicode.IsUpper(c) && i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+				// Last capital of an acronym starts the next word
+				boundary = true
+			case unicode.IsDigit(c) != unicode.IsDigit(prev):
+				boundary = true
+			}
+		}
+		if boundary {
+			words = append(words, cur)
+			cur = nil
+		}
+		cur = append(cur, unicode.ToLower(c))
+	}
+	if len(cur) > 0 {
+		words = append(words, cur)
+	}
+	return words
+}
+
+// camelMatch reports how many words had to be skipped to consume q as a
+// sequence of word prefixes, or -1 if it can't be done.
+func camelMatch(words [][]rune, q []rune) int {
+	memo := map[[2]int]int{}
+	var match func(wi, qi int) int
+	match = func(wi, qi int) int {
+		if qi == len(q) {
+			return 0
+		}
+		if wi == len(words) {
+			return -1
+		}
+		key := [2]int{wi, qi}
+		if v, ok := memo[key]; ok {
+			return v
+		}
+		best := -1
+		w := words[wi]
+		for n := min(len(q)-qi, len(w)); n >= 1; n-- {
+			if !hasRunePrefix(w, q[qi:qi+n]) {
+				continue
+			}
+			if rest := match(wi+1, qi+n); rest >= 0 && (best < 0 || rest < best) {
+				best = rest
+			}
+		}
+		if rest := match(wi+1, qi); rest >= 0 && (best < 0 || rest+1 < best) {
+			best = rest + 1
+		}
+		memo[key] = best
+		return best
+	}
+	return match(0, 0)
+}
+
+func hasRunePrefix(s, prefix []rune) bool {
+	if len(prefix) > len(s) {
+		return false
+	}
+	for i := range prefix {
+		if s[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fuzzyMatch checks q is a subsequence of name and returns how spread out
+// the matched characters are, or -1 if it isn't.
+func fuzzyMatch(name, q []rune) int {
+	first, last, qi := -1, -1, 0
+	for i, c := range name {
+		if qi < len(q) && c == q[qi] {
+			if first < 0 {
+				first = i
+			}
+			last = i
+			qi++
+		}
+	}
+	if qi < len(q) {
+		return -1
+	}
+	return last - first + 1 - len(q)
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// typedPackage is a workspace package that has been through go/types.
+type typedPackage struct {
+	Path  string // Import path
+	Dir   string
+	Files []*ast.File
+	Types *types.Package
+	Info  *types.Info
+}
+
+// typedWorkspace holds the type-checked workspace for the analysis endpoints.
+// It is rebuilt lazily from the workspace layout whenever updateIndex bumps
+// symbolVersion.
+type typedWorkspace struct {
+	Fset     *token.FileSet
+	Packages map[string]*typedPackage // By import path
+	Root     string
+	Version  uint64
+
+	pkgs     map[string]*PackageInfo // Import path -> package from the workspace layout
+	imported map[string]*types.Package
+	src      *sourceImporter
+
+	graphOnce sync.Once
+	graph     *callGraph
+}
+
+var (
+	typedCache *typedWorkspace
+	typedMutex sync.Mutex
+)
+
+// loadTypedWorkspace returns the type-checked workspace, reusing the cached one
+// while the symbol index is unchanged.
+func loadTypedWorkspace() (*typedWorkspace, error) {
+	typedMutex.Lock()
+	defer typedMutex.Unlock()
+
+	root := currentWorkDir
+	if root == "" {
+		return nil, errors.New("no workspace directory set")
+	}
+	_, version := snapshotSymbols()
+	if typedCache != nil && typedCache.Root == root && typedCache.Version == version {
+		return typedCache, nil
+	}
+	layout := snapshotLayout()
+	if layout == nil || layout.Root != root {
+		return nil, errors.New("workspace not indexed yet")
+	}
+
+	fset := token.NewFileSet()
+	ws := &typedWorkspace{
+		Fset:     fset,
+		Packages: map[string]*typedPackage{},
+		Root:     root,
+		Version:  version,
+		pkgs:     layout.packages(),
+		imported: map[string]*types.Package{},
+		src:      newSourceImporter(typeCheckContext(), fset),
+	}
+	// Dependencies from vendor/ or replace directives are only checked when imported
+	for _, mod := range layout.Modules {
+		if !mod.isMain() {
+			continue
+		}
+		for _, pkg := range mod.Packages {
+			if _, err := ws.check(pkg.ImportPath); err != nil {
+				log.Printf("Type check %s: %v\n", pkg.ImportPath, err)
+			}
+		}
+	}
+	log.Printf("Type-checked %d packages\n", len(ws.Packages))
+
+	typedCache = ws
+	return ws, nil
+}
+
+// typeCheckContext is the build target with the Go installation the editor
+// runs, so the source importer loads the matching standard library.
+func typeCheckContext() *build.Context {
+	ctxt := indexBuildContext()
+	goBin := findGoExecutable()
+	if !filepath.IsAbs(goBin) {
+		return ctxt
+	}
+	goroot := filepath.Dir(filepath.Dir(goBin))
+	if _, err := os.Stat(filepath.Join(goroot, "src", "runtime")); err == nil {
+		ctxt.GOROOT = goroot
+	}
+	return ctxt
+}
+
+// check type-checks the workspace package with the given import path,
+// checking its workspace dependencies first.
+func (ws *typedWorkspace) check(path string) (*types.Package, error) {
+	if pkg, ok := ws.Packages[path]; ok {
+		if pkg.Types == nil {
+			return nil, errors.New("import cycle through " + path)
+		}
+		return pkg.Types, nil
+	}
+	info := ws.pkgs[path]
+
+	var files []*ast.File
+	for _, name := range info.GoFiles {
+		f, err := parser.ParseFile(ws.Fset, filepath.Join(info.Dir, name), nil, parser.ParseComments)
+		if f == nil {
+			log.Printf("Parse %s: %v\n", name, err)
+			continue
+		}
+		files = append(files, f)
+	}
+
+	pkg := &typedPackage{Path: path, Dir: info.Dir, Files: files}
+	ws.Packages[path] = pkg // Placeholder so cycles are detected
+
+	pkg.Info = &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Defs:       map[*ast.Ident]types.Object{},
+		Uses:       map[*ast.Ident]types.Object{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+	}
+	conf := types.Config{
+		Importer:    (*workspaceImporter)(ws),
+		Error:       func(error) {}, // Keep going; partial information is still useful
+		FakeImportC: true,
+	}
+	pkg.Types, _ = conf.Check(path, ws.Fset, files, pkg.Info)
+	return pkg.Types, nil
+}
+
+// workspaceImporter resolves workspace packages through the typed workspace and
+// everything else (stdlib, module dependencies) from source.
+type workspaceImporter typedWorkspace
+
+func (wi *workspaceImporter) Import(path string) (*types.Package, error) {
+	return wi.ImportFrom(path, "", 0)
+}
+
+func (wi *workspaceImporter) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	ws := (*typedWorkspace)(wi)
+	if _, ok := ws.pkgs[path]; ok {
+		return ws.check(path)
+	}
+	pkg, err := ws.src.ImportFrom(path, dir, mode)
+	if err == nil {
+		ws.imported[pkg.Path()] = pkg
+	}
+	return pkg, err
+}
+
+// sourceImporter type-checks imported packages from source, finding them
+// with its own build context. go/importer's source importer can only use
+// build.Default, which is shared with everything else in the process.
+type sourceImporter struct {
+	ctxt     *build.Context
+	fset     *token.FileSet
+	packages map[string]*types.Package // By import path; nil while checking
+}
+
+func newSourceImporter(ctxt *build.Context, fset *token.FileSet) *sourceImporter {
+	return &sourceImporter{ctxt: ctxt, fset: fset, packages: map[string]*types.Package{}}
+}
+
+func (si *sourceImporter) Import(path string) (*types.Package, error) {
+	return si.ImportFrom(path, ".", 0)
+}
+
+// ImportFrom checks only declarations, not function bodies, and skips over
+// type errors, which is all importers of the package need.
+func (si *sourceImporter) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	bp, err := si.ctxt.Import(path, dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	if pkg, ok := si.packages[bp.ImportPath]; ok {
+		if pkg == nil {
+			return nil, errors.New("import cycle through " + bp.ImportPath)
+		}
+		return pkg, nil
+	}
+	si.packages[bp.ImportPath] = nil // Placeholder so cycles are detected
+
+	var files []*ast.File
+	for _, name := range append(append([]string{}, bp.GoFiles...), bp.CgoFiles...) {
+		f, err := parser.ParseFile(si.fset, filepath.Join(bp.Dir, name), nil, parser.SkipObjectResolution)
+		if f == nil {
+			delete(si.packages, bp.ImportPath)
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{
+		Importer:         si,
+		IgnoreFuncBodies: true,
+		FakeImportC:      true,
+		Error:            func(error) {},
+		Sizes:            types.SizesFor("gc", si.ctxt.GOARCH),
+	}
+	pkg, _ := conf.Check(bp.ImportPath, si.fset, files, nil)
+	si.packages[bp.ImportPath] = pkg
+	return pkg, nil
+}
+
+// allPackages returns the workspace packages followed by every package they
+// import, directly or indirectly.
+func (ws *typedWorkspace) allPackages() []*types.Package {
+	seen := map[*types.Package]bool{}
+	var out []*types.Package
+	var visit func(p *types.Package)
+	visit = func(p *types.Package) {
+		if p == nil || seen[p] {
+			return
+		}
+		seen[p] = true
+		out = append(out, p)
+		for _, imp := range p.Imports() {
+			visit(imp)
+		}
+	}
+	for _, pkg := range ws.Packages {
+		visit(pkg.Types)
+	}
+	for _, pkg := range ws.imported {
+		visit(pkg)
+	}
+	return out
+}
+
+// objectAt finds the object declared or referenced at a 1-based line and
+// column in a workspace file. A position on a func keyword or type spec
+// (as stored in the symbol index) resolves to the declared name.
+func (ws *typedWorkspace) objectAt(path string, line, col int) (types.Object, *typedPackage) {
+	for _, pkg := range ws.Packages {
+		for _, f := range pkg.Files {
+			tf := ws.Fset.File(f.Pos())
+			if tf == nil || !sameFile(tf.Name(), path) {
+				continue
+			}
+
+			var found *ast.Ident
+			ast.Inspect(f, func(n ast.Node) bool {
+				if n == nil || found != nil {
+					return false
+				}
+				start, end := ws.Fset.Position(n.Pos()), ws.Fset.Position(n.End())
+				if start.Line > line || end.Line < line {
+					return false
+				}
+				switch n := n.(type) {
+				case *ast.Ident:
+					if start.Line == line && start.Column <= col && col <= end.Column {
+						found = n
+					}
+				case *ast.FuncDecl:
+					if start.Line == line && start.Column == col {
+						found = n.Name
+					}
+				case *ast.TypeSpec:
+					if start.Line == line && start.Column == col {
+						found = n.Name
+					}
+				}
+				return true
+			})
+			if found == nil {
+				return nil, pkg
+			}
+			if obj := pkg.Info.Defs[found]; obj != nil {
+				return obj, pkg
+			}
+			return pkg.Info.Uses[found], pkg
+		}
+	}
+	return nil, nil
+}
+
+func sameFile(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	if filepath.Separator == '\\' {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"go/build"
+	"go/token"
+	"go/types"
+	"reflect"
+	"testing"
+)
+
+func TestSourceImporter(t *testing.T) {
+	before := build.Default
+	ctxt := *indexBuildContext()
+	ctxt.GOOS, ctxt.GOARCH = "windows", "amd64"
+	ctxt.CgoEnabled = false
+	dir := t.TempDir()
+
+	si := newSourceImporter(&ctxt, token.NewFileSet())
+	pkg, err := si.ImportFrom("strings", dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fn, ok := pkg.Scope().Lookup("ToUpper").(*types.Func); !ok || fn.Type().(*types.Signature).Params().Len() != 1 {
+		t.Errorf("strings.ToUpper = %v, want a function of one parameter", pkg.Scope().Lookup("ToUpper"))
+	}
+	if again, _ := si.Import("strings"); again != pkg {
+		t.Error("a second import checked strings again")
+	}
+
+	// The importer's own context picks the files, not the host's
+	sys, err := si.ImportFrom("syscall", dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sys.Scope().Lookup("CopySid") == nil {
+		t.Error("syscall.CopySid is missing for windows")
+	}
+	if sys.Scope().Lookup("InotifyInit") != nil {
+		t.Error("syscall.InotifyInit is declared for windows")
+	}
+
+	if !reflect.DeepEqual(build.Default, before) {
+		t.Error("build.Default was modified")
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	watchDebounce = 200 * time.Millisecond
+	pollInterval  = 2 * time.Second
+	sseKeepAlive  = 30 * time.Second
+)
+
+// File change event types.
+const (
+	eventCreated  = "created"
+	eventModified = "modified"
+	eventDeleted  = "deleted"
+)
+
+// FileEvent is a change to a workspace path, as pushed to clients.
+type FileEvent struct {
+	Type  string `json:"type"`
+	Path  string `json:"path"`
+	IsDir bool   `json:"isDir"`
+}
+
+// workspaceWatcher collects raw changes from the platform watcher (or the
+// poller), debounces them, updates the index and publishes them.
+type workspaceWatcher struct {
+	root   string
+	ignore *ignoreEngine
+	stop   chan struct{}
+
+	mu      sync.Mutex
+	pending map[string]FileEvent
+	known   map[string]bool // Paths that exist, as far as events tell
+	timer   *time.Timer
+}
+
+var (
+	watcher      *workspaceWatcher
+	watcherMutex sync.Mutex
+)
+
+// watchWorkspace (re)starts watching root, stopping any previous watcher.
+// It uses the platform's change notifications where available and falls
+// back to polling.
+func watchWorkspace(root string) {
+	watcherMutex.Lock()
+	defer watcherMutex.Unlock()
+	if watcher != nil {
+		close(watcher.stop)
+		watcher = nil
+	}
+	if root == "" {
+		return
+	}
+
+	w := &workspaceWatcher{
+		root:    root,
+		ignore:  newIgnoreEngine(root),
+		stop:    make(chan struct{}),
+		pending: make(map[string]FileEvent),
+		known:   make(map[string]bool),
+	}
+	watcher = w
+	if err := startNativeWatcher(w); err != nil {
+		log.Printf("Native file watching unavailable (%v), polling %s\n", err, root)
+		go w.poll()
+	}
+}
+
+// notify records a raw change. Consecutive changes to one path collapse:
+// created+modified is created, created+deleted is nothing, and
+// deleted+created is modified. A create of a path that already exists is
+// a modification too: atomic saves rename a temporary file over the
+// original.
+func (w *workspaceWatcher) notify(ev FileEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if ev.Type == eventCreated && w.known[ev.Path] {
+		ev.Type = eventModified
+	}
+	switch ev.Type {
+	case eventCreated, eventModified:
+		w.known[ev.Path] = true
+	case eventDeleted:
+		delete(w.known, ev.Path)
+		if ev.IsDir {
+			prefix := ev.Path + string(filepath.Separator)
+			for path := range w.known {
+				if strings.HasPrefix(path, prefix) {
+					delete(w.known, path)
+				}
+			}
+		}
+	}
+
+	if prev, ok := w.pending[ev.Path]; ok {
+		switch {
+		case prev.Type == eventCreated && ev.Type == eventDeleted:
+			delete(w.pending, ev.Path)
+			return
+		case prev.Type == eventCreated:
+			ev.Type = eventCreated
+		case prev.Type == eventDeleted && ev.Type == eventCreated:
+			ev.Type = eventModified
+		}
+	}
+	w.pending[ev.Path] = ev
+
+	if w.timer == nil {
+		w.timer = time.AfterFunc(watchDebounce, w.flush)
+	} else {
+		w.timer.Reset(watchDebounce)
+	}
+}
+
+func (w *workspaceWatcher) flush() {
+	w.mu.Lock()
+	events := make([]FileEvent, 0, len(w.pending))
+	paths := make([]string, 0, len(w.pending))
+	for _, ev := range w.pending {
+		events = append(events, ev)
+		paths = append(paths, ev.Path)
+	}
+	w.pending = make(map[string]FileEvent)
+	w.mu.Unlock()
+
+	select {
+	case <-w.stop:
+		return
+	default:
+	}
+	if len(events) == 0 {
+		return
+	}
+	for _, ev := range events {
+		if ev.Type != eventModified {
+			invalidateFileList() // Content changes leave the file list as it is
+			break
+		}
+	}
+	invalidateGitStatus()
+	updateIndexPaths(w.root, paths...)
+	publishEvents(events)
+}
+
+// ignored reports whether a changed path is left out of the workspace,
+// checking its ancestors too since events arrive for any depth.
+func (w *workspaceWatcher) ignored(path string, isDir bool) bool {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil || rel == "." {
+		return false
+	}
+	for dir := filepath.Dir(path); pathWithin(w.root, dir) && dir != w.root; dir = filepath.Dir(dir) {
+		if w.ignore.ignored(dir, true) {
+			return true
+		}
+	}
+	return w.ignore.ignored(path, isDir)
+}
+
+type pollEntry struct {
+	modTime time.Time
+	size    int64
+	isDir   bool
+}
+
+// poll is the fallback watcher: it rescans the workspace every pollInterval
+// and reports the differences.
+func (w *workspaceWatcher) poll() {
+	prev := w.scan()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+		cur := w.scan()
+		for path, e := range cur {
+			old, ok := prev[path]
+			switch {
+			case !ok:
+				w.notify(FileEvent{Type: eventCreated, Path: path, IsDir: e.isDir})
+			case !e.isDir && (old.modTime != e.modTime || old.size != e.size):
+				w.notify(FileEvent{Type: eventModified, Path: path})
+			}
+		}
+		for path, e := range prev {
+			if _, ok := cur[path]; !ok {
+				w.notify(FileEvent{Type: eventDeleted, Path: path, IsDir: e.isDir})
+			}
+		}
+		prev = cur
+	}
+}
+
+func (w *workspaceWatcher) scan() map[string]pollEntry {
+	entries := make(map[string]pollEntry)
+	filepath.WalkDir(w.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == w.root {
+			return nil
+		}
+		if w.ignore.ignored(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		entries[path] = pollEntry{modTime: info.ModTime(), size: info.Size(), isDir: d.IsDir()}
+		return nil
+	})
+	return entries
+}
+
+// Clients listening on /api/events.
+var (
+	eventClients      = make(map[chan []FileEvent]bool)
+	eventClientsMutex sync.Mutex
+)
+
+func publishEvents(events []FileEvent) {
+	eventClientsMutex.Lock()
+	defer eventClientsMutex.Unlock()
+	for ch := range eventClients {
+		select {
+		case ch <- events:
+		default:
+			log.Println("Dropping file events for a slow client")
+		}
+	}
+}
+
+// handleEvents streams file change events as Server-Sent Events, one
+// "files" event holding a JSON array per debounced batch.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := make(chan []FileEvent, 16)
+	eventClientsMutex.Lock()
+	eventClients[ch] = true
+	eventClientsMutex.Unlock()
+	defer func() {
+		eventClientsMutex.Lock()
+		delete(eventClients, ch)
+		eventClientsMutex.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case events := <-ch:
+			data, _ := json.Marshal(events)
+			fmt.Fprintf(w, "event: files\ndata: %s\n\n", data)
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,155 @@
+//go:build linux
+
+package main
+
+import (
+	"io/fs"
+	"log"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF
+
+// inotifyWatcher watches every non-ignored directory of the workspace.
+type inotifyWatcher struct {
+	ws   *workspaceWatcher
+	fd   int
+	dirs map[int32]string
+}
+
+// startNativeWatcher watches the workspace with inotify. It fails if the
+// watch limit is too low for the tree, so the caller can poll instead.
+func startNativeWatcher(ws *workspaceWatcher) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+	iw := &inotifyWatcher{ws: ws, fd: fd, dirs: make(map[int32]string)}
+	if err := iw.addTree(ws.root, false); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	go iw.run()
+	return nil
+}
+
+// addTree watches dir and its subdirectories. For a directory that appeared
+// after watching started, its contents are reported as created, since their
+// events happened before the watch existed.
+func (iw *inotifyWatcher) addTree(dir string, report bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != iw.ws.root && iw.ws.ignore.ignored(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case !report:
+			iw.ws.known[path] = true // Events aren't read yet, so no lock
+		case path != dir:
+			iw.ws.notify(FileEvent{Type: eventCreated, Path: path, IsDir: d.IsDir()})
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		wd, err := syscall.InotifyAddWatch(iw.fd, path, inotifyMask)
+		if err != nil {
+			if err == syscall.ENOSPC {
+				return err // Out of watches: give up on inotify
+			}
+			return nil
+		}
+		iw.dirs[int32(wd)] = path
+		return nil
+	})
+}
+
+func (iw *inotifyWatcher) run() {
+	defer syscall.Close(iw.fd)
+
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		log.Println("epoll:", err)
+		return
+	}
+	defer syscall.Close(epfd)
+	ev := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(iw.fd)}
+	if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, iw.fd, &ev); err != nil {
+		log.Println("epoll:", err)
+		return
+	}
+
+	buf := make([]byte, 64*1024)
+	events := make([]syscall.EpollEvent, 1)
+	for {
+		select {
+		case <-iw.ws.stop:
+			return
+		default:
+		}
+		// Wake up regularly to notice the watcher being stopped
+		n, err := syscall.EpollWait(epfd, events, 500)
+		if err != nil && err != syscall.EINTR {
+			log.Println("epoll:", err)
+			return
+		}
+		if n <= 0 {
+			continue
+		}
+		n, err = syscall.Read(iw.fd, buf)
+		if err != nil || n <= 0 {
+			continue
+		}
+		iw.handle(buf[:n])
+	}
+}
+
+func (iw *inotifyWatcher) handle(buf []byte) {
+	for offset := 0; offset+syscall.SizeofInotifyEvent <= len(buf); {
+		raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(raw.Len)]
+		offset += syscall.SizeofInotifyEvent + int(raw.Len)
+
+		dir, ok := iw.dirs[raw.Wd]
+		if !ok {
+			continue
+		}
+		if raw.Mask&syscall.IN_DELETE_SELF != 0 {
+			delete(iw.dirs, raw.Wd)
+			continue
+		}
+		name := string(nameBytes)
+		for len(name) > 0 && name[len(name)-1] == 0 {
+			name = name[:len(name)-1]
+		}
+		if name == "" {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		isDir := raw.Mask&syscall.IN_ISDIR != 0
+		if iw.ws.ignored(path, isDir) {
+			continue
+		}
+		switch {
+		case raw.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+			iw.ws.notify(FileEvent{Type: eventCreated, Path: path, IsDir: isDir})
+			if isDir {
+				if err := iw.addTree(path, true); err != nil {
+					log.Printf("Watch %s: %v\n", path, err)
+				}
+			}
+		case raw.Mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+			iw.ws.notify(FileEvent{Type: eventDeleted, Path: path, IsDir: isDir})
+		case raw.Mask&(syscall.IN_MODIFY|syscall.IN_CLOSE_WRITE) != 0:
+			iw.ws.notify(FileEvent{Type: eventModified, Path: path})
+		}
+	}
+}
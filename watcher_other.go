@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// startNativeWatcher has no implementation here yet; the workspace is polled.
+func startNativeWatcher(ws *workspaceWatcher) error {
+	return errors.New("not supported on this platform")
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"go/build"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// Module sources, in the order they are discovered.
+const (
+	sourceGoWork    = "go.work"   // Listed in a go.work use directive
+	sourceWorkspace = "workspace" // A go.mod (or loose files) under the workspace root
+	sourceReplace   = "replace"   // Target of a replace directive
+	sourceVendor    = "vendor"    // Listed in vendor/modules.txt
+)
+
+type ModuleInfo struct {
+	Path      string         `json:"path"` // Empty for loose files outside any module
+	Dir       string         `json:"dir"`
+	GoVersion string         `json:"goVersion,omitempty"`
+	Source    string         `json:"source"`
+	Packages  []*PackageInfo `json:"packages"`
+}
+
+type PackageInfo struct {
+	ImportPath   string   `json:"importPath"`
+	Name         string   `json:"name"`
+	Dir          string   `json:"dir"`
+	Module       string   `json:"module"`
+	GoFiles      []string `json:"goFiles"`                // Matching the build context, tests excluded
+	TestGoFiles  []string `json:"testGoFiles,omitempty"`  // In-package and external tests
+	IgnoredFiles []string `json:"ignoredFiles,omitempty"` // Excluded by build constraints
+	Imports      []string `json:"imports,omitempty"`
+}
+
+type WorkspaceLayout struct {
+	Root    string        `json:"root"`
+	GoWork  string        `json:"goWork,omitempty"`
+	GOOS    string        `json:"goos"`
+	GOARCH  string        `json:"goarch"`
+	Modules []*ModuleInfo `json:"modules"`
+}
+
+// isMain reports whether the module is part of the user's own code rather
+// than a vendored or replaced dependency.
+func (m *ModuleInfo) isMain() bool {
+	return m.Source == sourceGoWork || m.Source == sourceWorkspace
+}
+
+// indexedFiles returns the full paths of the files the symbol index covers.
+func (p *PackageInfo) indexedFiles() []string {
+	var files []string
+	for _, name := range append(append([]string{}, p.GoFiles...), p.TestGoFiles...) {
+		files = append(files, filepath.Join(p.Dir, name))
+	}
+	return files
+}
+
+// packages returns every package in the layout keyed by import path. Main
+// modules win over vendored or replaced copies of the same path.
+func (l *WorkspaceLayout) packages() map[string]*PackageInfo {
+	pkgs := map[string]*PackageInfo{}
+	for _, main := range []bool{false, true} {
+		for _, mod := range l.Modules {
+			if mod.isMain() != main {
+				continue
+			}
+			for _, pkg := range mod.Packages {
+				pkgs[pkg.ImportPath] = pkg
+			}
+		}
+	}
+	return pkgs
+}
+
+// scanWorkspace discovers the modules under root (and those a go.work file
+// points at) and groups their Go files into packages.
+func scanWorkspace(root string, ctxt *build.Context) *WorkspaceLayout {
+	layout := &WorkspaceLayout{Root: root, GOOS: ctxt.GOOS, GOARCH: ctxt.GOARCH}
+	seen := map[string]bool{}
+
+	add := func(dir, path, source string) {
+		dir = filepath.Clean(dir)
+		if seen[dir] {
+			return
+		}
+		seen[dir] = true
+		mod := &ModuleInfo{Path: path, Dir: dir, Source: source}
+		if data, err := os.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+			if mf, err := modfile.ParseLax(filepath.Join(dir, "go.mod"), data, nil); err == nil {
+				if mod.Path == "" && mf.Module != nil {
+					mod.Path = mf.Module.Mod.Path
+				}
+				if mf.Go != nil {
+					mod.GoVersion = mf.Go.Version
+				}
+			}
+		}
+		layout.Modules = append(layout.Modules, mod)
+	}
+
+	// 1. go.work use directives
+	goWork := filepath.Join(root, "go.work")
+	if data, err := os.ReadFile(goWork); err == nil {
+		if wf, err := modfile.ParseWork(goWork, data, nil); err == nil {
+			layout.GoWork = goWork
+			for _, use := range wf.Use {
+				add(resolveModuleDir(root, use.Path), "", sourceGoWork)
+			}
+		} else {
+			log.Printf("Parse %s: %v\n", goWork, err)
+		}
+	}
+
+	// 2. Every go.mod under the root; loose files at the root form a pseudo-module
+	ignore := newIgnoreEngine(root)
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && (skipIndexDir(d.Name()) || ignore.ignored(path, true)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() == "go.mod" {
+			add(filepath.Dir(path), "", sourceWorkspace)
+		}
+		return nil
+	})
+	add(root, "", sourceWorkspace)
+
+	// 3. Dependencies of the main modules, if enabled
+	for _, mod := range append([]*ModuleInfo{}, layout.Modules...) {
+		if config.IndexReplaced {
+			for _, rep := range readReplaces(mod.Dir) {
+				add(rep.dir, rep.path, sourceReplace)
+			}
+		}
+		if config.IndexVendor {
+			for _, path := range readVendoredModules(mod.Dir) {
+				add(filepath.Join(mod.Dir, "vendor", filepath.FromSlash(path)), path, sourceVendor)
+			}
+		}
+	}
+
+	for _, mod := range layout.Modules {
+		mod.Packages = collectPackages(mod, ctxt, seen, ignore)
+	}
+
+	// Drop the root pseudo-module if it holds no loose files
+	modules := layout.Modules[:0]
+	for _, mod := range layout.Modules {
+		if mod.Path != "" || len(mod.Packages) > 0 {
+			modules = append(modules, mod)
+		}
+	}
+	layout.Modules = modules
+	return layout
+}
+
+// skipIndexDir reports whether a directory is never part of a package tree
+// for the go tool, whatever the workspace ignore rules say.
+func skipIndexDir(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") ||
+		name == "node_modules" || name == "vendor" || name == "testdata"
+}
+
+func resolveModuleDir(base, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, filepath.FromSlash(path))
+}
+
+type replacedModule struct {
+	path string // Import path the code uses
+	dir  string
+}
+
+// readReplaces returns the on-disk location of each replace target in the
+// module's go.mod: a local directory or a module cache entry.
+func readReplaces(modDir string) []replacedModule {
+	gomod := filepath.Join(modDir, "go.mod")
+	data, err := os.ReadFile(gomod)
+	if err != nil {
+		return nil
+	}
+	mf, err := modfile.ParseLax(gomod, data, nil)
+	if err != nil {
+		return nil
+	}
+
+	var out []replacedModule
+	for _, rep := range mf.Replace {
+		dir := ""
+		if rep.New.Version == "" {
+			dir = resolveModuleDir(modDir, rep.New.Path)
+		} else if cache := goModCache(); cache != "" {
+			escPath, err1 := module.EscapePath(rep.New.Path)
+			escVer, err2 := module.EscapeVersion(rep.New.Version)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			dir = filepath.Join(cache, filepath.FromSlash(escPath)+"@"+escVer)
+		}
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			out = append(out, replacedModule{path: rep.Old.Path, dir: dir})
+		}
+	}
+	return out
+}
+
+// readVendoredModules lists the module paths recorded in vendor/modules.txt.
+func readVendoredModules(modDir string) []string {
+	f, err := os.Open(filepath.Join(modDir, "vendor", "modules.txt"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var paths []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// "# golang.org/x/text v0.33.0" or "# example.com/a => ../a"
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "# ") {
+			continue
+		}
+		fields := strings.Fields(line[2:])
+		if len(fields) > 0 {
+			paths = append(paths, fields[0])
+		}
+	}
+	return paths
+}
+
+var (
+	modCacheOnce sync.Once
+	modCache     string
+)
+
+// goModCache returns the module cache directory as the go command sees it,
+// including settings made with go env -w. It is looked up once.
+func goModCache() string {
+	modCacheOnce.Do(func() {
+		out, err := runGo(context.Background(), "", "env", "GOMODCACHE")
+		if err != nil {
+			log.Printf("go env GOMODCACHE: %v\n", err)
+		}
+		if modCache = strings.TrimSpace(string(out)); err != nil || modCache == "" {
+			modCache = goModCacheFromEnv()
+		}
+	})
+	return modCache
+}
+
+// goModCacheFromEnv works the module cache out from the environment, for
+// when the go command can't be run.
+func goModCacheFromEnv() string {
+	if cache := os.Getenv("GOMODCACHE"); cache != "" {
+		return cache
+	}
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		gopath = build.Default.GOPATH
+	}
+	if gopath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.SplitList(gopath)[0], "pkg", "mod")
+}
+
+// collectPackages groups the module's Go files into packages, stopping at the
+// roots of other modules and at directories the workspace ignores.
+func collectPackages(mod *ModuleInfo, ctxt *build.Context, moduleDirs map[string]bool, ignore *ignoreEngine) []*PackageInfo {
+	var pkgs []*PackageInfo
+	filepath.WalkDir(mod.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != mod.Dir {
+			if skipIndexDir(d.Name()) || moduleDirs[path] || ignore.ignored(path, true) {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir // Nested module that wasn't discovered
+			}
+		}
+
+		if pkg := scanPackage(mod, path, ctxt, ignore); pkg != nil {
+			pkgs = append(pkgs, pkg)
+		}
+		return nil
+	})
+	return pkgs
+}
+
+// scanPackage reads the package in dir, a directory of mod, returning nil
+// if it holds no Go files the workspace doesn't ignore.
+func scanPackage(mod *ModuleInfo, dir string, ctxt *build.Context, ignore *ignoreEngine) *PackageInfo {
+	bp, _ := ctxt.ImportDir(dir, 0)
+	if bp == nil {
+		return nil
+	}
+	keep := func(lists ...[]string) []string {
+		names := []string{}
+		for _, list := range lists {
+			for _, name := range list {
+				if !ignore.ignored(filepath.Join(dir, name), false) {
+					names = append(names, name)
+				}
+			}
+		}
+		return names
+	}
+	goFiles := keep(bp.GoFiles, bp.CgoFiles, bp.InvalidGoFiles)
+	testFiles := keep(bp.TestGoFiles, bp.XTestGoFiles)
+	ignoredFiles := keep(bp.IgnoredGoFiles)
+	if len(goFiles)+len(testFiles)+len(ignoredFiles) == 0 {
+		return nil
+	}
+
+	rel, err := filepath.Rel(mod.Dir, dir)
+	if err != nil {
+		return nil
+	}
+	importPath := mod.Path
+	switch {
+	case rel == ".":
+		if importPath == "" {
+			importPath = "."
+		}
+	case importPath == "":
+		importPath = filepath.ToSlash(rel)
+	default:
+		importPath += "/" + filepath.ToSlash(rel)
+	}
+
+	return &PackageInfo{
+		ImportPath:   importPath,
+		Name:         bp.Name,
+		Dir:          dir,
+		Module:       mod.Path,
+		GoFiles:      goFiles,
+		TestGoFiles:  testFiles,
+		IgnoredFiles: ignoredFiles,
+		Imports:      bp.Imports,
+	}
+}
+
+// rescanPackages returns a copy of layout with the packages in dirs read
+// again from disk. It returns nil if a directory lies outside every module
+// of the layout, in which case only a full scan will do.
+func rescanPackages(layout *WorkspaceLayout, dirs []string, ctxt *build.Context) *WorkspaceLayout {
+	modules := make([]*ModuleInfo, len(layout.Modules))
+	for i, mod := range layout.Modules {
+		m := *mod
+		modules[i] = &m
+	}
+	ignore := newIgnoreEngine(layout.Root)
+	for _, dir := range dirs {
+		var owner *ModuleInfo
+		for _, mod := range modules {
+			if pathWithin(mod.Dir, dir) && (owner == nil || len(mod.Dir) > len(owner.Dir)) {
+				owner = mod
+			}
+		}
+		if owner == nil {
+			return nil
+		}
+
+		var pkg *PackageInfo
+		if packageDir(owner.Dir, dir, ignore) {
+			pkg = scanPackage(owner, dir, ctxt, ignore)
+		}
+		pkgs := make([]*PackageInfo, 0, len(owner.Packages)+1)
+		for _, p := range owner.Packages {
+			if !sameFile(p.Dir, dir) {
+				pkgs = append(pkgs, p)
+			} else if pkg != nil {
+				pkgs = append(pkgs, pkg) // Keep its place
+				pkg = nil
+			}
+		}
+		if pkg != nil {
+			pkgs = append(pkgs, pkg)
+		}
+		owner.Packages = pkgs
+	}
+	return &WorkspaceLayout{Root: layout.Root, GoWork: layout.GoWork, GOOS: ctxt.GOOS, GOARCH: ctxt.GOARCH, Modules: modules}
+}
+
+// packageDir reports whether collectPackages would visit dir when walking
+// the module in modDir.
+func packageDir(modDir, dir string, ignore *ignoreEngine) bool {
+	for d := dir; !sameFile(d, modDir); d = filepath.Dir(d) {
+		if d == filepath.Dir(d) {
+			return false
+		}
+		if skipIndexDir(filepath.Base(d)) || ignore.ignored(d, true) {
+			return false
+		}
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func snapshotLayout() *WorkspaceLayout {
+	cacheMutex.RLock()
+	defer cacheMutex.RUnlock()
+	return workspaceLayout
+}
+
+// handleModules returns the module layout of the workspace. A POST updates the
+// dependency indexing options and re-indexes.
+func handleModules(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	if r.Method == "OPTIONS" {
+		return
+	}
+
+	if r.Method == "POST" {
+		var req struct {
+			IndexVendor   *bool `json:"indexVendor"`
+			IndexReplaced *bool `json:"indexReplaced"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.IndexVendor != nil {
+			config.IndexVendor = *req.IndexVendor
+		}
+		if req.IndexReplaced != nil {
+			config.IndexReplaced = *req.IndexReplaced
+		}
+		saveConfig()
+		if currentWorkDir != "" {
+			updateIndex(currentWorkDir)
+		}
+	}
+
+	layout := snapshotLayout()
+	if layout == nil {
+		http.Error(w, "Workspace not indexed yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(layout)
+}
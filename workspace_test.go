@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// layoutPackages lists a layout's packages as import path -> files.
+func layoutPackages(l *WorkspaceLayout) map[string][]string {
+	pkgs := map[string][]string{}
+	for _, mod := range l.Modules {
+		for _, pkg := range mod.Packages {
+			files := append(append([]string{}, pkg.GoFiles...), pkg.TestGoFiles...)
+			files = append(files, pkg.IgnoredFiles...)
+			sort.Strings(files)
+			pkgs[pkg.ImportPath] = files
+		}
+	}
+	return pkgs
+}
+
+func TestRescanPackages(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string) {
+		t.Helper()
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module example.com/m\n")
+	write("a/a.go", "package a\n")
+	write("b/b.go", "package b\n")
+	write("sub/go.mod", "module example.com/sub\n")
+	write("sub/s.go", "package sub\n")
+
+	ctxt := indexBuildContext()
+	layout := scanWorkspace(root, ctxt)
+
+	write("a/a_test.go", "package a\n")
+	write("c/c.go", "package c\n")
+	write("testdata/t.go", "package t\n")
+	write("sub/x/x.go", "package x\n")
+	if err := os.RemoveAll(filepath.Join(root, "b")); err != nil {
+		t.Fatal(err)
+	}
+	dirs := []string{"a", "b", "c", "testdata", "sub/x"}
+	for i, d := range dirs {
+		dirs[i] = filepath.Join(root, filepath.FromSlash(d))
+	}
+
+	got := rescanPackages(layout, dirs, ctxt)
+	if got == nil {
+		t.Fatal("rescanPackages returned nil")
+	}
+	want := scanWorkspace(root, ctxt)
+	if g, w := layoutPackages(got), layoutPackages(want); !reflect.DeepEqual(g, w) {
+		t.Errorf("rescanned packages %v, want %v", g, w)
+	}
+	if _, ok := layoutPackages(layout)["example.com/m/b"]; !ok {
+		t.Error("rescanPackages modified the original layout")
+	}
+
+	if l := rescanPackages(layout, []string{filepath.Dir(root)}, ctxt); l != nil {
+		t.Error("rescanPackages outside every module should return nil")
+	}
+}
+
+func TestScanWorkspaceIgnoredFiles(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"go.mod":        "module example.com/m\n",
+		".gitignore":    "gen_*.go\n",
+		"main.go":       "package main\n",
+		"gen_api.go":    "package main\n",
+		"gen/g.go":      "package gen\n",
+		"only/gen_x.go": "package only\n",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := layoutPackages(scanWorkspace(root, indexBuildContext()))
+	want := map[string][]string{
+		"example.com/m":     {"main.go"},
+		"example.com/m/gen": {"g.go"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("packages = %v, want %v", got, want)
+	}
+}